@@ -1,32 +1,51 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/contrib/fiberzerolog"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/healthcheck"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/template/html/v2"
+	"github.com/rawnly/votestreet/internal/config"
 	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/internal/jobs"
+	"github.com/rawnly/votestreet/internal/market"
 	"github.com/rawnly/votestreet/internal/storage"
+	"github.com/rawnly/votestreet/internal/tokens"
 	utils "github.com/rawnly/votestreet/internal/util"
+	"github.com/rawnly/votestreet/pkg/authenticator"
 	"github.com/rawnly/votestreet/pkg/useragent/honeypot"
 	router "github.com/rawnly/votestreet/web"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/voxelite-ai/env"
 )
 
+const FinalizePollsInterval = 1 * time.Minute
+
+// the sentiment index is refreshed incrementally,
+// the periodic rebuild drops the buckets of deleted votes
 const (
-	LimiterRedisDB  = 0
-	HoneypotRedisDB = 1
+	SentimentRefreshInterval = 1 * time.Minute
+	SentimentRebuildInterval = 24 * time.Hour
 )
 
+const ResolvePollsInterval = 5 * time.Minute
+
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 
@@ -37,68 +56,374 @@ func main() {
 	// info 1
 	// debug 0
 	// trace -1
+	configPath := flag.String("config", env.String("CONFIG_FILE", ""), "path to a YAML config file")
 	level := flag.Int("log-level", 1, "Set log level")
 	port := flag.Int("port", 8080, "set http port")
 	debug := flag.Bool("debug", false, "set debug mode")
 	flag.Parse()
 
-	if err := database.Connect(); err != nil {
-		log.Fatal().Err(err).Msg("Failed to connect to database")
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load config")
+	}
+
+	// flags override the file and the environment only when set
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "log-level":
+			cfg.Server.LogLevel = *level
+		case "port":
+			cfg.Server.Port = *port
+		case "debug":
+			cfg.Server.Debug = *debug
+		}
+	})
+
+	if flag.Arg(0) == "config" {
+		if err := printConfig(cfg, flag.Args()[1:]); err != nil {
+			log.Fatal().Err(err).Msg("Invalid config")
+		}
+
+		return
 	}
 
-	if err := database.CreateTables(); err != nil {
-		log.Fatal().Err(err).Msg("Failed to create tables")
+	if err := cfg.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid config")
+	}
+
+	zerolog.SetGlobalLevel(zerolog.Level(cfg.Server.LogLevel))
+
+	if cfg.Server.Debug {
+		log.Logger = log.Output(zerolog.ConsoleWriter{
+			Out: os.Stderr,
+		})
+	} else {
+		log.Logger = log.With().Caller().Logger()
+	}
+
+	storage.Configure(cfg.Storage, cfg.Redis)
+
+	if err := database.Connect(cfg.Database); err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to database")
 	}
 
 	defer database.Close()
 
+	if flag.Arg(0) == "migrate" {
+		if err := migrate(context.Background(), flag.Args()[1:]); err != nil {
+			log.Fatal().Err(err).Msg("Migration failed")
+		}
+
+		return
+	}
+
+	if flag.Arg(0) == "tickers" {
+		if err := importTickers(context.Background(), flag.Args()[1:]); err != nil {
+			log.Fatal().Err(err).Msg("Ticker import failed")
+		}
+
+		return
+	}
+
+	if _, err := database.MigrateUp(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate database")
+	}
+
+	if seeded, err := database.SeedTickers(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("Failed to seed tickers")
+	} else if seeded > 0 {
+		log.Info().Int("count", seeded).Msg("Seeded ticker registry")
+	}
+
+	providers, err := authenticator.New(cfg.Auth.Providers)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure oauth providers")
+	}
+
+	// cancelled on SIGINT/SIGTERM, stops every background worker
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	workers := &jobs.Group{}
+	workers.Go(func() { providers.Start(ctx, authenticator.DefaultRefreshInterval) })
+	store := database.Postgres{}
+
+	workers.Go(func() {
+		jobs.Every(ctx, "finalize-polls", FinalizePollsInterval, func(ctx context.Context) error {
+			return finalizePolls(ctx, store)
+		})
+	})
+
+	workers.Go(func() {
+		jobs.Every(ctx, "refresh-sentiment", SentimentRefreshInterval, func(ctx context.Context) error {
+			return refreshSentiment(ctx, store, false)
+		})
+	})
+
+	workers.Go(func() {
+		jobs.Every(ctx, "rebuild-sentiment", SentimentRebuildInterval, func(ctx context.Context) error {
+			return refreshSentiment(ctx, store, true)
+		})
+	})
+
+	var prices market.PriceSource
+	if cfg.Prices.File != "" {
+		source, err := market.NewCSVSource(cfg.Prices.File, cfg.Prices.MaxAge)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to load prices")
+		}
+
+		prices = source
+		workers.Go(func() {
+			jobs.Every(ctx, "resolve-polls", ResolvePollsInterval, func(ctx context.Context) error {
+				return resolvePolls(ctx, store, source, cfg.Prices.ResolutionDelay, cfg.Prices.ResolutionTimeout)
+			})
+		})
+	}
+
+	issuer, err := tokens.New(cfg.Auth.TokenSigningKey, storage.Get(cfg.Redis.Databases.Tokens))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure token issuer")
+	}
+
+	var shuttingDown atomic.Bool
+
 	engine := html.New("./views", ".html")
 	app := fiber.New(fiber.Config{
-		Views: engine,
+		Views:        engine,
+		ErrorHandler: router.ErrorHandler,
 	})
 
 	app.Use(
+		// first, so every error response carries the request ID
+		requestid.New(requestid.Config{
+			Generator: func() string { return utils.RandomStringPrefixed("req_", 7) },
+		}),
+		recover.New(),
 		helmet.New(),
 		healthcheck.New(healthcheck.Config{
 			ReadinessEndpoint: "/healthz",
 			ReadinessProbe: func(c *fiber.Ctx) bool {
-				return storage.IsRedisHealthy(c.Context())
+				return !shuttingDown.Load() && storage.IsHealthy(c.Context()) && providers.Ready()
 			},
 			LivenessProbe: func(c *fiber.Ctx) bool {
 				return true
 			},
 		}),
 		limiter.New(limiter.Config{
-			Storage: storage.Redis(LimiterRedisDB),
+			Storage:    storage.Get(cfg.Redis.Databases.Limiter),
+			Max:        cfg.Limiter.Max,
+			Expiration: cfg.Limiter.Expiration,
 			Next: func(c *fiber.Ctx) bool {
-				return c.IP() == "127.0.0.1" || *debug
+				return c.IP() == "127.0.0.1" || cfg.Server.Debug
+			},
+			LimitReached: func(c *fiber.Ctx) error {
+				return fiber.ErrTooManyRequests
 			},
 		}),
 		fiberzerolog.New(fiberzerolog.Config{
 			Logger: &log.Logger,
 			Fields: []string{"ip", "ua", "latency", "requestId", "status", "method", "url", "error"},
 		}),
-		requestid.New(requestid.Config{
-			Generator: func() string { return utils.RandomStringPrefixed("req_", 7) },
-		}),
-		honeypot.New(storage.Redis(HoneypotRedisDB)),
+		honeypot.New(storage.Get(cfg.Redis.Databases.Honeypot)),
 	)
 
-	logLevel := zerolog.Level(*level)
-	zerolog.SetGlobalLevel(logLevel)
+	if err := router.Init(ctx, app, router.Options{
+		Workers:   workers,
+		Databases: cfg.Redis.Databases,
+		Providers: providers,
+		Issuer:    issuer,
+		Polls:     store,
+		Votes:     store,
+		Users:     store,
+		Tickers:   store,
+		Sentiment: store,
+		Prices:    prices,
+	}); err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize router")
+	}
 
-	if *debug {
-		log.Logger = log.Output(zerolog.ConsoleWriter{
-			Out: os.Stderr,
-		})
-	} else {
-		log.Logger = log.With().Caller().Logger()
+	listenErr := make(chan error, 1)
+	go func() {
+		log.Info().Int("port", cfg.Server.Port).Msg("Server started")
+		listenErr <- app.Listen(fmt.Sprintf(":%d", cfg.Server.Port))
+	}()
+
+	var serveErr error
+
+	select {
+	case serveErr = <-listenErr:
+		log.Error().Err(serveErr).Msg("Server stopped")
+		stop()
+	case <-ctx.Done():
+		log.Info().Dur("delay", cfg.Server.ShutdownDelay).Msg("Shutting down")
+		shuttingDown.Store(true)
+
+		// keep serving while the load balancers notice the failing readiness probe
+		time.Sleep(cfg.Server.ShutdownDelay)
+
+		if err := app.ShutdownWithTimeout(cfg.Server.ShutdownTimeout); err != nil {
+			log.Error().Err(err).Msg("Failed to drain connections")
+		}
 	}
 
-	if err := router.Init(app); err != nil {
-		log.Fatal().Err(err).Msg("Failed to initialize router")
+	shutdown(workers, cfg.Server.ShutdownTimeout)
+
+	if serveErr != nil {
+		os.Exit(1)
+	}
+
+	log.Info().Msg("Server stopped")
+}
+
+// shutdown waits for the background workers, then closes the storages and postgres
+func shutdown(workers *jobs.Group, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := workers.Wait(ctx); err != nil {
+		log.Error().Err(err).Msg("Background workers did not stop in time")
+	}
+
+	// the postgres storage backend relies on the database pool
+	if err := storage.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close storage")
+	}
+
+	if err := database.Close(); err != nil {
+		log.Error().Err(err).Msg("Failed to close database")
+	}
+}
+
+// printConfig runs the `config print` subcommand,
+// the secrets are redacted and the config is validated after printing
+func printConfig(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: config print")
+	}
+
+	data, err := cfg.Redacted().YAML()
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(data))
+
+	return cfg.Validate()
+}
+
+// finalizePolls snapshots the results of the polls that just closed
+func finalizePolls(ctx context.Context, polls database.PollStore) error {
+	finalized, err := polls.FinalizeClosedPolls(ctx)
+	if finalized > 0 {
+		log.Info().Int("polls", finalized).Msg("Finalized closed polls")
+	}
+
+	return err
+}
+
+// resolvePolls records the outcome of the polls that closed at least delay ago,
+// or marks them unresolvable after the timeout
+func resolvePolls(ctx context.Context, polls database.PollStore, prices market.PriceSource, delay, timeout time.Duration) error {
+	resolved, err := market.ResolvePolls(ctx, polls, prices, delay, timeout)
+	if resolved > 0 {
+		log.Info().Int("polls", resolved).Msg("Resolved closed polls")
+	}
+
+	return err
+}
+
+// refreshSentiment materializes the votes cast since the last refresh,
+// or the whole retention period when full
+func refreshSentiment(ctx context.Context, sentiment database.SentimentStore, full bool) error {
+	refreshed, err := sentiment.RefreshSentiment(ctx, full)
+	if refreshed > 0 {
+		log.Debug().Int64("buckets", refreshed).Bool("full", full).Msg("Refreshed sentiment index")
+	}
+
+	return err
+}
+
+// importTickers runs the `tickers import <file.csv>` subcommand,
+// the file has the same columns as the bundled registry
+func importTickers(ctx context.Context, args []string) error {
+	if len(args) != 2 || args[0] != "import" {
+		return fmt.Errorf("usage: tickers import <file.csv>")
+	}
+
+	if _, err := database.MigrateUp(ctx); err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tickers, err := database.ParseTickersCSV(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[1], err)
+	}
+
+	imported, err := database.UpsertTickers(ctx, tickers)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d ticker(s)\n", imported)
+
+	return nil
+}
+
+// migrate runs the `migrate up|down [steps]|status` subcommand
+func migrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid steps %q", args[1])
+			}
+
+			steps = n
+		}
+
+		reverted, err := database.MigrateDown(ctx, steps)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Reverted %d migration(s)\n", len(reverted))
+	case "status":
+		statuses, err := database.MigrationsStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Printf("%04d  %-30s  %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
 	}
 
-	log.Info().Int("port", *port).Msg("Server started")
-	log.Fatal().Err(app.Listen(fmt.Sprintf(":%d", *port))).Msg("Server stopped")
+	return nil
 }
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rawnly/votestreet/pkg/authenticator"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the server,
+// loaded from the defaults, a YAML file, the environment and the flags, in this order
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	Storage  Storage  `yaml:"storage"`
+	Redis    Redis    `yaml:"redis"`
+	Limiter  Limiter  `yaml:"limiter"`
+	Auth     Auth     `yaml:"auth"`
+	Prices   Prices   `yaml:"prices"`
+}
+
+type Server struct {
+	Port     int  `yaml:"port"`
+	Debug    bool `yaml:"debug"`
+	LogLevel int  `yaml:"log_level"`
+	// ShutdownDelay keeps serving after readiness turns false,
+	// so load balancers stop routing before connections are refused
+	ShutdownDelay time.Duration `yaml:"shutdown_delay"`
+	// ShutdownTimeout bounds the draining of in-flight requests and workers
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Database struct {
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// Storage selects the backend of the key/value storages (sessions, limiter, tokens, cache)
+type Storage struct {
+	// Backend is one of redis, memory or postgres,
+	// memory and postgres only fan out live results within the instance
+	Backend string `yaml:"backend"`
+}
+
+type Redis struct {
+	Host      string         `yaml:"host"`
+	Port      int            `yaml:"port"`
+	Username  string         `yaml:"username"`
+	Password  string         `yaml:"password"`
+	TLS       bool           `yaml:"tls"`
+	Databases RedisDatabases `yaml:"databases"`
+}
+
+// RedisDatabases are the database indexes of each redis client
+type RedisDatabases struct {
+	Limiter  int `yaml:"limiter"`
+	Honeypot int `yaml:"honeypot"`
+	Sessions int `yaml:"sessions"`
+	Tokens   int `yaml:"tokens"`
+	Results  int `yaml:"results"`
+	// PubSub only selects the connection, channels are shared across databases
+	PubSub int `yaml:"pubsub"`
+}
+
+type Limiter struct {
+	Max        int           `yaml:"max"`
+	Expiration time.Duration `yaml:"expiration"`
+}
+
+type Auth struct {
+	TokenSigningKey string                         `yaml:"token_signing_key"`
+	Providers       []authenticator.ProviderConfig `yaml:"providers"`
+}
+
+// Prices configures the price source used to resolve polls,
+// resolution is disabled without a file
+type Prices struct {
+	// File is a CSV of symbol,time,price rows
+	File string `yaml:"file"`
+	// MaxAge is how old a price can be and still count as the price at a time
+	MaxAge time.Duration `yaml:"max_age"`
+	// ResolutionDelay waits after closes_at for the closing price to be recorded
+	ResolutionDelay time.Duration `yaml:"resolution_delay"`
+	// ResolutionTimeout gives up on polls still without a closing price this long after closes_at
+	ResolutionTimeout time.Duration `yaml:"resolution_timeout"`
+}
+
+// Default returns the configuration used for local development
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:            8080,
+			LogLevel:        1,
+			ShutdownDelay:   5 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: Database{
+			DSN:          "user=postgres dbname=votestreet sslmode=disable",
+			MaxIdleConns: 2,
+		},
+		Storage: Storage{
+			Backend: "redis",
+		},
+		Redis: Redis{
+			Host: "localhost",
+			Port: 6379,
+			Databases: RedisDatabases{
+				Limiter:  0,
+				Honeypot: 1,
+				Sessions: 2,
+				Tokens:   3,
+				Results:  4,
+				PubSub:   0,
+			},
+		},
+		Limiter: Limiter{
+			Max:        5,
+			Expiration: 1 * time.Minute,
+		},
+		Prices: Prices{
+			MaxAge:            96 * time.Hour,
+			ResolutionDelay:   1 * time.Hour,
+			ResolutionTimeout: 7 * 24 * time.Hour,
+		},
+	}
+}
+
+// Load reads the defaults, the file at path if any and the environment,
+// the result should be validated once the flags are applied
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+
+	if err := config.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %d is out of range", c.Server.Port))
+	}
+
+	if c.Server.ShutdownDelay < 0 || c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_delay cannot be negative and server.shutdown_timeout must be positive"))
+	}
+
+	if c.Database.DSN == "" {
+		errs = append(errs, errors.New("database.dsn is required"))
+	}
+
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("database pool settings cannot be negative"))
+	}
+
+	switch c.Storage.Backend {
+	case "redis", "memory", "postgres":
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend %q must be one of redis, memory or postgres", c.Storage.Backend))
+	}
+
+	if c.Redis.Host == "" {
+		errs = append(errs, errors.New("redis.host is required"))
+	}
+
+	if c.Redis.Port < 1 || c.Redis.Port > 65535 {
+		errs = append(errs, fmt.Errorf("redis.port %d is out of range", c.Redis.Port))
+	}
+
+	for _, db := range []struct {
+		name  string
+		index int
+	}{
+		{"limiter", c.Redis.Databases.Limiter},
+		{"honeypot", c.Redis.Databases.Honeypot},
+		{"sessions", c.Redis.Databases.Sessions},
+		{"tokens", c.Redis.Databases.Tokens},
+		{"results", c.Redis.Databases.Results},
+		{"pubsub", c.Redis.Databases.PubSub},
+	} {
+		if db.index < 0 || db.index > 15 {
+			errs = append(errs, fmt.Errorf("redis.databases.%s %d is out of range", db.name, db.index))
+		}
+	}
+
+	if c.Limiter.Max < 1 {
+		errs = append(errs, errors.New("limiter.max must be positive"))
+	}
+
+	if c.Limiter.Expiration <= 0 {
+		errs = append(errs, errors.New("limiter.expiration must be positive"))
+	}
+
+	if c.Prices.MaxAge <= 0 || c.Prices.ResolutionDelay < 0 {
+		errs = append(errs, errors.New("prices.max_age must be positive and prices.resolution_delay cannot be negative"))
+	}
+
+	if c.Prices.ResolutionTimeout <= c.Prices.ResolutionDelay {
+		errs = append(errs, errors.New("prices.resolution_timeout must be longer than prices.resolution_delay"))
+	}
+
+	if c.Auth.TokenSigningKey == "" {
+		errs = append(errs, errors.New("auth.token_signing_key is required"))
+	}
+
+	if len(c.Auth.Providers) == 0 {
+		errs = append(errs, errors.New("auth.providers requires at least one provider"))
+	}
+
+	names := make(map[string]bool)
+	for _, provider := range c.Auth.Providers {
+		provider = provider.WithDefaults()
+		if err := provider.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if names[provider.Name] {
+			errs = append(errs, fmt.Errorf("oauth provider %q is configured twice", provider.Name))
+		}
+
+		names[provider.Name] = true
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rawnly/votestreet/pkg/authenticator"
+	"github.com/voxelite-ai/env"
+)
+
+// loadEnv overrides the config with the environment variables that are set.
+//
+//	PORT, DEBUG, LOG_LEVEL, SHUTDOWN_DELAY, SHUTDOWN_TIMEOUT
+//	DATABASE_URL, DATABASE_MAX_OPEN_CONNS, DATABASE_MAX_IDLE_CONNS, DATABASE_CONN_MAX_LIFETIME
+//	STORAGE_BACKEND
+//	REDIS_HOST, REDIS_PORT, REDIS_USERNAME, REDIS_PASSWORD, REDIS_TLS
+//	REDIS_LIMITER_DB, REDIS_HONEYPOT_DB, REDIS_SESSIONS_DB, REDIS_TOKENS_DB, REDIS_RESULTS_DB, REDIS_PUBSUB_DB
+//	LIMITER_MAX, LIMITER_EXPIRATION
+//	TOKEN_SIGNING_KEY
+//	PRICES_FILE, PRICES_MAX_AGE, PRICES_RESOLUTION_DELAY, PRICES_RESOLUTION_TIMEOUT
+//
+// OAuth providers are read by providersFromEnv.
+func (c *Config) loadEnv() error {
+	var errs []error
+
+	parse := func(key string, fn func(value string) error) {
+		if value := env.StringPtr(key); value != nil {
+			if err := fn(*value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", key, err))
+			}
+		}
+	}
+
+	str := func(key string, target *string) {
+		parse(key, func(value string) error {
+			*target = value
+			return nil
+		})
+	}
+
+	integer := func(key string, target *int) {
+		parse(key, func(value string) (err error) {
+			*target, err = strconv.Atoi(value)
+			return err
+		})
+	}
+
+	boolean := func(key string, target *bool) {
+		parse(key, func(value string) (err error) {
+			*target, err = strconv.ParseBool(value)
+			return err
+		})
+	}
+
+	duration := func(key string, target *time.Duration) {
+		parse(key, func(value string) (err error) {
+			*target, err = time.ParseDuration(value)
+			return err
+		})
+	}
+
+	integer("PORT", &c.Server.Port)
+	boolean("DEBUG", &c.Server.Debug)
+	integer("LOG_LEVEL", &c.Server.LogLevel)
+	duration("SHUTDOWN_DELAY", &c.Server.ShutdownDelay)
+	duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	str("DATABASE_URL", &c.Database.DSN)
+	integer("DATABASE_MAX_OPEN_CONNS", &c.Database.MaxOpenConns)
+	integer("DATABASE_MAX_IDLE_CONNS", &c.Database.MaxIdleConns)
+	duration("DATABASE_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime)
+
+	str("STORAGE_BACKEND", &c.Storage.Backend)
+
+	str("REDIS_HOST", &c.Redis.Host)
+	integer("REDIS_PORT", &c.Redis.Port)
+	str("REDIS_USERNAME", &c.Redis.Username)
+	str("REDIS_PASSWORD", &c.Redis.Password)
+	boolean("REDIS_TLS", &c.Redis.TLS)
+	integer("REDIS_LIMITER_DB", &c.Redis.Databases.Limiter)
+	integer("REDIS_HONEYPOT_DB", &c.Redis.Databases.Honeypot)
+	integer("REDIS_SESSIONS_DB", &c.Redis.Databases.Sessions)
+	integer("REDIS_TOKENS_DB", &c.Redis.Databases.Tokens)
+	integer("REDIS_RESULTS_DB", &c.Redis.Databases.Results)
+	integer("REDIS_PUBSUB_DB", &c.Redis.Databases.PubSub)
+
+	integer("LIMITER_MAX", &c.Limiter.Max)
+	duration("LIMITER_EXPIRATION", &c.Limiter.Expiration)
+
+	str("TOKEN_SIGNING_KEY", &c.Auth.TokenSigningKey)
+
+	str("PRICES_FILE", &c.Prices.File)
+	duration("PRICES_MAX_AGE", &c.Prices.MaxAge)
+	duration("PRICES_RESOLUTION_DELAY", &c.Prices.ResolutionDelay)
+	duration("PRICES_RESOLUTION_TIMEOUT", &c.Prices.ResolutionTimeout)
+
+	for _, provider := range providersFromEnv() {
+		c.Auth.setProvider(provider)
+	}
+
+	return errors.Join(errs...)
+}
+
+// setProvider replaces the provider with the same name, or adds it
+func (a *Auth) setProvider(provider authenticator.ProviderConfig) {
+	for i := range a.Providers {
+		if a.Providers[i].Name == provider.Name {
+			a.Providers[i] = provider
+			return
+		}
+	}
+
+	a.Providers = append(a.Providers, provider)
+}
+
+// providersFromEnv reads the OAuth providers from the environment.
+//
+// Each builtin provider is enabled when its client ID is set:
+//
+//	GOOGLE_AUTH_CLIENT_ID, GOOGLE_AUTH_CLIENT_SECRET, GOOGLE_AUTH_REDIRECT_URI
+//	GITHUB_AUTH_CLIENT_ID, GITHUB_AUTH_CLIENT_SECRET, GITHUB_AUTH_REDIRECT_URI
+//	MICROSOFT_AUTH_CLIENT_ID, MICROSOFT_AUTH_CLIENT_SECRET, MICROSOFT_AUTH_REDIRECT_URI, MICROSOFT_AUTH_TENANT
+//	GITLAB_AUTH_CLIENT_ID, GITLAB_AUTH_CLIENT_SECRET, GITLAB_AUTH_REDIRECT_URI, GITLAB_AUTH_ISSUER
+//
+// Generic OIDC issuers are listed in OIDC_PROVIDERS (comma separated) and configured
+// with <NAME>_AUTH_ISSUER, <NAME>_AUTH_CLIENT_ID, <NAME>_AUTH_CLIENT_SECRET, <NAME>_AUTH_REDIRECT_URI,
+// and optionally <NAME>_AUTH_SCOPES and <NAME>_AUTH_CLAIM_{SUBJECT,EMAIL,EMAIL_VERIFIED,FIRST_NAME,LAST_NAME,NAME}
+func providersFromEnv() []authenticator.ProviderConfig {
+	var providers []authenticator.ProviderConfig
+
+	builtins := []string{
+		authenticator.ProviderGoogle,
+		authenticator.ProviderGitHub,
+		authenticator.ProviderMicrosoft,
+		authenticator.ProviderGitLab,
+	}
+
+	for _, name := range builtins {
+		prefix := strings.ToUpper(name) + "_AUTH_"
+		if env.StringPtr(prefix+"CLIENT_ID") == nil {
+			continue
+		}
+
+		providers = append(providers, authenticator.ProviderConfig{
+			Name:         name,
+			Issuer:       env.String(prefix+"ISSUER", ""),
+			Tenant:       env.String(prefix+"TENANT", ""),
+			ClientID:     env.String(prefix + "CLIENT_ID"),
+			ClientSecret: env.String(prefix+"CLIENT_SECRET", ""),
+			RedirectURI:  env.String(prefix+"REDIRECT_URI", ""),
+		})
+	}
+
+	for _, name := range splitList(env.String("OIDC_PROVIDERS", "")) {
+		name = strings.ToLower(name)
+		prefix := strings.ToUpper(name) + "_AUTH_"
+
+		providers = append(providers, authenticator.ProviderConfig{
+			Name:         name,
+			Type:         authenticator.TypeOIDC,
+			Issuer:       env.String(prefix+"ISSUER", ""),
+			ClientID:     env.String(prefix+"CLIENT_ID", ""),
+			ClientSecret: env.String(prefix+"CLIENT_SECRET", ""),
+			RedirectURI:  env.String(prefix+"REDIRECT_URI", ""),
+			Scopes:       splitList(env.String(prefix+"SCOPES", "")),
+			Claims: authenticator.ClaimMapping{
+				Subject:       env.String(prefix+"CLAIM_SUBJECT", ""),
+				Email:         env.String(prefix+"CLAIM_EMAIL", ""),
+				EmailVerified: env.String(prefix+"CLAIM_EMAIL_VERIFIED", ""),
+				FirstName:     env.String(prefix+"CLAIM_FIRST_NAME", ""),
+				LastName:      env.String(prefix+"CLAIM_LAST_NAME", ""),
+				Name:          env.String(prefix+"CLAIM_NAME", ""),
+			},
+		})
+	}
+
+	return providers
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"net/url"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[redacted]"
+
+var dsnPasswordRegex = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Redacted returns a copy of the config with the secrets masked
+func (c *Config) Redacted() *Config {
+	copied := *c
+
+	copied.Database.DSN = redactDSN(c.Database.DSN)
+	copied.Redis.Password = redact(c.Redis.Password)
+	copied.Auth.TokenSigningKey = redact(c.Auth.TokenSigningKey)
+
+	copied.Auth.Providers = append(copied.Auth.Providers[:0:0], c.Auth.Providers...)
+	for i := range copied.Auth.Providers {
+		copied.Auth.Providers[i].ClientSecret = redact(copied.Auth.Providers[i].ClientSecret)
+	}
+
+	return &copied
+}
+
+// YAML encodes the config, secrets included
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return redacted
+}
+
+// redactDSN masks the password of both URL and key/value connection strings
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		dsn = u.Redacted()
+	}
+
+	return dsnPasswordRegex.ReplaceAllString(dsn, "${1}"+redacted)
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// PollSort orders a poll listing, newest first by default
+type PollSort string
+
+const (
+	PollSortNewest PollSort = "newest"
+	PollSortVotes  PollSort = "votes_count"
+)
+
+var ErrInvalidCursor = &Error{Kind: ErrValidation, Message: "invalid cursor"}
+
+// PollCursor is the keyset position of the last poll of a page,
+// clients only see it encoded
+type PollCursor struct {
+	Sort       PollSort  `json:"s"`
+	CreatedAt  time.Time `json:"c"`
+	ID         int64     `json:"i"`
+	VotesCount int       `json:"v,omitempty"`
+}
+
+// cursorAfter is the cursor that resumes the listing after the poll
+func cursorAfter(poll Poll, sort PollSort) *PollCursor {
+	return &PollCursor{
+		Sort:       sort,
+		CreatedAt:  poll.CreatedAt,
+		ID:         poll.ID,
+		VotesCount: poll.VotesCount,
+	}
+}
+
+func (c PollCursor) Encode() string {
+	payload, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// DecodePollCursor decodes a cursor, it must have been issued for the same sort
+func DecodePollCursor(value string, sort PollSort) (*PollCursor, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor PollCursor
+	if err := json.Unmarshal(payload, &cursor); err != nil || cursor.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// Precedes reports whether the poll comes after the cursor in its sort order
+func (c PollCursor) Precedes(poll Poll) bool {
+	if c.Sort == PollSortVotes && poll.VotesCount != c.VotesCount {
+		return poll.VotesCount < c.VotesCount
+	}
+
+	if !poll.CreatedAt.Equal(c.CreatedAt) {
+		return poll.CreatedAt.Before(c.CreatedAt)
+	}
+
+	return poll.ID < c.ID
+}
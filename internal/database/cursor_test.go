@@ -0,0 +1,81 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodePollCursor(t *testing.T) {
+	createdAt := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	issued := PollCursor{Sort: PollSortVotes, CreatedAt: createdAt, ID: 42, VotesCount: 7}
+
+	tests := []struct {
+		name  string
+		value string
+		sort  PollSort
+		want  *PollCursor
+	}{
+		{"round trip", issued.Encode(), PollSortVotes, &issued},
+		{"other sort", issued.Encode(), PollSortNewest, nil},
+		{"not base64", "not a cursor!", PollSortVotes, nil},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("[1, 2")), PollSortVotes, nil},
+		{"padded", base64.URLEncoding.EncodeToString([]byte(`{"s":"newest"}`)), PollSortNewest, nil},
+		{"empty", "", PollSortNewest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := DecodePollCursor(tt.value, tt.sort)
+
+			if tt.want == nil {
+				if !errors.Is(err, ErrValidation) {
+					t.Fatalf("DecodePollCursor() error = %v, want a validation error", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cursor.Sort != tt.want.Sort || !cursor.CreatedAt.Equal(tt.want.CreatedAt) || cursor.ID != tt.want.ID || cursor.VotesCount != tt.want.VotesCount {
+				t.Errorf("DecodePollCursor() = %+v, want %+v", cursor, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollCursorPrecedes(t *testing.T) {
+	createdAt := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	earlier, later := createdAt.Add(-time.Second), createdAt.Add(time.Second)
+
+	tests := []struct {
+		name   string
+		cursor PollCursor
+		poll   Poll
+		want   bool
+	}{
+		{"newest older poll", PollCursor{Sort: PollSortNewest, CreatedAt: createdAt, ID: 10}, Poll{CreatedAt: earlier, ID: 20}, true},
+		{"newest newer poll", PollCursor{Sort: PollSortNewest, CreatedAt: createdAt, ID: 10}, Poll{CreatedAt: later, ID: 5}, false},
+		{"newest tie lower id", PollCursor{Sort: PollSortNewest, CreatedAt: createdAt, ID: 10}, Poll{CreatedAt: createdAt, ID: 9}, true},
+		{"newest tie higher id", PollCursor{Sort: PollSortNewest, CreatedAt: createdAt, ID: 10}, Poll{CreatedAt: createdAt, ID: 11}, false},
+		{"newest same poll", PollCursor{Sort: PollSortNewest, CreatedAt: createdAt, ID: 10}, Poll{CreatedAt: createdAt, ID: 10}, false},
+		{"newest ignores votes", PollCursor{Sort: PollSortNewest, CreatedAt: createdAt, ID: 10, VotesCount: 1}, Poll{CreatedAt: earlier, ID: 10, VotesCount: 9}, true},
+		{"votes fewer votes", PollCursor{Sort: PollSortVotes, CreatedAt: createdAt, ID: 10, VotesCount: 5}, Poll{CreatedAt: later, ID: 20, VotesCount: 4}, true},
+		{"votes more votes", PollCursor{Sort: PollSortVotes, CreatedAt: createdAt, ID: 10, VotesCount: 5}, Poll{CreatedAt: earlier, ID: 1, VotesCount: 6}, false},
+		{"votes tie older poll", PollCursor{Sort: PollSortVotes, CreatedAt: createdAt, ID: 10, VotesCount: 5}, Poll{CreatedAt: earlier, ID: 20, VotesCount: 5}, true},
+		{"votes tie same time lower id", PollCursor{Sort: PollSortVotes, CreatedAt: createdAt, ID: 10, VotesCount: 5}, Poll{CreatedAt: createdAt, ID: 9, VotesCount: 5}, true},
+		{"votes tie newer poll", PollCursor{Sort: PollSortVotes, CreatedAt: createdAt, ID: 10, VotesCount: 5}, Poll{CreatedAt: later, ID: 1, VotesCount: 5}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cursor.Precedes(tt.poll); got != tt.want {
+				t.Errorf("Precedes() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	_ "github.com/lib/pq"
+	"github.com/rawnly/votestreet/internal/config"
 	"go4.org/syncutil"
 )
 
@@ -17,10 +18,18 @@ func Get() *sql.DB {
 	return database
 }
 
-func Connect() error {
+func Connect(config config.Database) error {
 	err := once.Do(func() (err error) {
-		database, err = sql.Open("postgres", "user=postgres dbname=votestreet sslmode=disable")
-		return err
+		database, err = sql.Open("postgres", config.DSN)
+		if err != nil {
+			return err
+		}
+
+		database.SetMaxOpenConns(config.MaxOpenConns)
+		database.SetMaxIdleConns(config.MaxIdleConns)
+		database.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+		return nil
 	})
 
 	return err
@@ -34,28 +43,4 @@ func Close() error {
 	return database.Close()
 }
 
-func CreateTables() error {
-	if err := createUsersTable(); err != nil {
-		return err
-	}
-
-	if err := createPollsTable(); err != nil {
-		return err
-	}
-
-	if err := createVotesTable(); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func execute(query string) error {
-	if _, err := database.Exec(query); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 var ErrDatabaseNotConnected = errors.New("database not connected")
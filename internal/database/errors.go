@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of domain errors, match them with errors.Is
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrForbidden  = errors.New("forbidden")
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error is a domain error of a kind, optionally wrapping its cause
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	return e.Kind.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+
+	return []error{e.Kind, e.Err}
+}
+
+var ErrDuplicateVote = &Error{Kind: ErrConflict, Message: "user already voted on this poll"}
+
+// postgres error codes translated into domain errors
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqNotNullViolation    = "23502"
+	pqCheckViolation      = "23514"
+	pqStringTooLong       = "22001"
+	pqInvalidText         = "22P02"
+)
+
+// Translate maps sql.ErrNoRows and constraint violations into domain errors,
+// other errors are returned untouched
+func Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return err
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, Err: err}
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		if pqErr.Constraint == "votes_pk_2" {
+			return ErrDuplicateVote
+		}
+
+		return &Error{Kind: ErrConflict, Message: "already exists", Err: err}
+	case pqForeignKeyViolation:
+		return &Error{Kind: ErrValidation, Message: "references a missing resource", Err: err}
+	case pqNotNullViolation, pqCheckViolation, pqStringTooLong, pqInvalidText:
+		return &Error{Kind: ErrValidation, Message: "invalid value", Err: err}
+	default:
+		return err
+	}
+}
+
+// translate passes a result through and translates its error
+func translate[T any](v T, err error) (T, error) {
+	return v, Translate(err)
+}
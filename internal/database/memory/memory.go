@@ -0,0 +1,851 @@
+// Package memory implements the database stores in memory,
+// mirroring the semantics of the postgres queries for tests
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"html"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/pkg/ticker"
+)
+
+// errNotFound is what the postgres stores return for missing rows
+var errNotFound = database.Translate(sql.ErrNoRows)
+
+var (
+	_ database.PollStore      = (*Store)(nil)
+	_ database.VoteStore      = (*Store)(nil)
+	_ database.UserStore      = (*Store)(nil)
+	_ database.TickerStore    = (*Store)(nil)
+	_ database.SentimentStore = (*Store)(nil)
+)
+
+type poll struct {
+	database.Poll
+	finalizedAt  *time.Time
+	finalResults []byte
+	// votes are keyed by voter
+	votes map[string]*vote
+}
+
+type vote struct {
+	id        int64
+	value     string
+	createdAt time.Time
+	updatedAt *time.Time
+}
+
+type token struct {
+	database.PersonalAccessToken
+	hash string
+}
+
+// Store implements every store, safe for concurrent use
+type Store struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	polls  map[int64]*poll
+	users  map[int]*database.User
+	tokens map[int]*token
+	// tickers are keyed by symbol
+	tickers map[string]database.Ticker
+	hooks   []database.VoteHook
+
+	lastPollID   int64
+	lastOptionID int64
+	lastVoteID   int64
+	lastUserID   int
+	lastTokenID  int
+}
+
+// New returns an empty store with the bundled ticker registry, like a seeded database
+func New() *Store {
+	s := &Store{
+		now: func() time.Time {
+			return time.Now().UTC()
+		},
+		polls:   make(map[int64]*poll),
+		users:   make(map[int]*database.User),
+		tokens:  make(map[int]*token),
+		tickers: make(map[string]database.Ticker),
+	}
+
+	// the bundled registry is valid, it is parsed on every start
+	tickers, _ := database.BundledTickers()
+	for _, ticker := range tickers {
+		s.tickers[ticker.Symbol] = ticker
+	}
+
+	return s
+}
+
+// SetClock replaces the clock used for timestamps and poll statuses
+func (s *Store) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = now
+}
+
+// view copies the poll with its computed status
+func (s *Store) view(p *poll, withOptions bool) database.Poll {
+	result := p.Poll
+	result.Status = result.StatusAt(s.now())
+	result.Options = nil
+
+	if withOptions {
+		result.Options = slices.Clone(p.Options)
+	}
+
+	return result
+}
+
+func (s *Store) InsertPoll(_ context.Context, payload database.Poll) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastPollID++
+	now := s.now()
+
+	p := &poll{
+		Poll:  payload,
+		votes: make(map[string]*vote),
+	}
+	p.ID = s.lastPollID
+	p.VotesCount = 0
+	p.CreatedAt = now
+	p.Outcome = nil
+
+	if p.OpensAt == nil {
+		p.OpensAt = &now
+	}
+
+	p.Options = make([]database.PollOption, len(payload.Options))
+	for position, option := range payload.Options {
+		s.lastOptionID++
+		p.Options[position] = database.PollOption{
+			ID:        s.lastOptionID,
+			PollID:    p.ID,
+			Position:  position,
+			Value:     option.Value,
+			Sentiment: option.Sentiment,
+			MeetsRule: option.MeetsRule,
+		}
+	}
+
+	s.polls[p.ID] = p
+
+	return p.ID, nil
+}
+
+func (s *Store) GetPollByID(_ context.Context, id int64) (database.Poll, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.polls[id]
+	if !ok {
+		return database.Poll{}, errNotFound
+	}
+
+	return s.view(p, true), nil
+}
+
+func (s *Store) ListPolls(_ context.Context, filter database.PollFilter) (database.PollPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filter.Limit = max(filter.Limit, 1)
+
+	var polls []database.Poll
+	for _, p := range s.polls {
+		poll := s.view(p, false)
+		if matches(poll, filter) {
+			polls = append(polls, poll)
+		}
+	}
+
+	// a poll sorts first when the other comes after it
+	sort.Slice(polls, func(i, j int) bool {
+		return cursorAt(polls[i], filter.Sort).Precedes(polls[j])
+	})
+
+	if len(polls) > filter.Limit+1 {
+		polls = polls[:filter.Limit+1]
+	}
+
+	return database.Paginate(polls, filter), nil
+}
+
+// SearchPolls approximates the postgres search, every term must prefix a word
+// of the title or the description, title matches rank higher
+func (s *Store) SearchPolls(_ context.Context, query string, limit int) ([]database.SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	terms := database.SearchTerms(query)
+	tickers := database.SearchSymbols(query)
+
+	results := []database.SearchResult{}
+	for _, p := range s.polls {
+		if p.Draft {
+			continue
+		}
+
+		result := database.SearchResult{Poll: s.view(p, false)}
+
+		text := p.Title
+		if p.Description != nil {
+			text += " " + *p.Description
+		}
+
+		titleWords := database.SearchTerms(p.Title)
+		words := database.SearchTerms(text)
+
+		matched := len(terms) > 0
+		for _, term := range terms {
+			prefixes := func(word string) bool { return strings.HasPrefix(word, term) }
+
+			switch {
+			case slices.ContainsFunc(titleWords, prefixes):
+				result.Rank += 0.1
+			case slices.ContainsFunc(words, prefixes):
+				result.Rank += 0.05
+			default:
+				matched = false
+			}
+		}
+
+		if slices.Contains(tickers, p.Ticker) {
+			result.Rank++
+		} else if !matched {
+			continue
+		}
+
+		result.Snippet = html.EscapeString(text)
+		results = append(results, result)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+
+		return cursorAt(results[i].Poll, database.PollSortNewest).Precedes(results[j].Poll)
+	})
+
+	if len(results) > max(limit, 1) {
+		results = results[:max(limit, 1)]
+	}
+
+	return results, nil
+}
+
+// matches mirrors the conditions of the postgres listing
+func matches(poll database.Poll, filter database.PollFilter) bool {
+	switch {
+	case filter.UserID != nil && (poll.UserID == nil || *poll.UserID != *filter.UserID):
+		return false
+	case filter.Public && poll.Draft:
+		return false
+	case filter.Ticker != "" && poll.Ticker != filter.Ticker:
+		return false
+	case filter.Status != "" && poll.Status != filter.Status:
+		return false
+	case filter.CreatedAfter != nil && poll.CreatedAt.Before(*filter.CreatedAfter):
+		return false
+	case filter.CreatedBefore != nil && !poll.CreatedAt.Before(*filter.CreatedBefore):
+		return false
+	case filter.After != nil && !filter.After.Precedes(poll):
+		return false
+	default:
+		return true
+	}
+}
+
+func cursorAt(poll database.Poll, sort database.PollSort) database.PollCursor {
+	return database.PollCursor{
+		Sort:       sort,
+		CreatedAt:  poll.CreatedAt,
+		ID:         poll.ID,
+		VotesCount: poll.VotesCount,
+	}
+}
+
+func (s *Store) UpdatePollSchedule(_ context.Context, id, userID int, update database.ScheduleUpdate) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.polls[int64(id)]
+	if !ok || p.finalizedAt != nil {
+		return 0, nil
+	}
+
+	if p.UserID == nil || *p.UserID != userID {
+		return 0, database.ErrNotPollOwner
+	}
+
+	opensAt, closesAt, err := update.Apply(*p.OpensAt, p.ClosesAt, p.Resolution != nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if update.Draft != nil {
+		p.Draft = *update.Draft
+	}
+
+	p.OpensAt, p.ClosesAt = &opensAt, closesAt
+
+	return 1, nil
+}
+
+func (s *Store) DeletePollByIDAndUserID(_ context.Context, id, userID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.polls[int64(id)]
+	if !ok {
+		return 0, nil
+	}
+
+	if p.UserID == nil || *p.UserID != userID {
+		return 0, database.ErrNotPollOwner
+	}
+
+	delete(s.polls, p.ID)
+
+	return 1, nil
+}
+
+func (s *Store) FinalizeClosedPolls(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	finalized := 0
+
+	for _, p := range s.sortedPolls() {
+		if p.finalizedAt != nil || p.ClosesAt == nil || p.ClosesAt.After(now) {
+			continue
+		}
+
+		snapshot, err := json.Marshal(s.results(p))
+		if err != nil {
+			return finalized, err
+		}
+
+		p.finalizedAt = &now
+		p.finalResults = snapshot
+		finalized++
+	}
+
+	return finalized, nil
+}
+
+func (s *Store) GetPollsToResolve(_ context.Context, delay time.Duration) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	closedBefore := s.now().Add(-delay)
+
+	var polls []*poll
+	for _, p := range s.polls {
+		if p.Resolution != nil && !p.Draft && p.Outcome == nil && p.ClosesAt != nil && !p.ClosesAt.After(closedBefore) {
+			polls = append(polls, p)
+		}
+	}
+
+	sort.Slice(polls, func(i, j int) bool {
+		return polls[i].ClosesAt.Before(*polls[j].ClosesAt)
+	})
+
+	ids := make([]int64, len(polls))
+	for i, p := range polls {
+		ids[i] = p.ID
+	}
+
+	return ids, nil
+}
+
+func (s *Store) ResolvePoll(_ context.Context, id int64, outcome database.Outcome) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.polls[id]
+	if !ok || p.Outcome != nil {
+		return 0, nil
+	}
+
+	p.Outcome = &outcome
+
+	return 1, nil
+}
+
+// checkPollOpen returns the poll unless it does not accept votes,
+// the lock must be held
+func (s *Store) checkPollOpen(pollID int64) (*poll, error) {
+	p, ok := s.polls[pollID]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	switch p.StatusAt(s.now()) {
+	case database.PollStatusOpen:
+		return p, nil
+	case database.PollStatusClosed:
+		return nil, database.ErrPollClosed
+	default:
+		return nil, database.ErrPollNotOpen
+	}
+}
+
+// adjustOptionCount moves the tally of an option by delta
+func adjustOptionCount(p *poll, value string, delta int) error {
+	for i := range p.Options {
+		if p.Options[i].Value == value {
+			p.Options[i].VotesCount += delta
+			return nil
+		}
+	}
+
+	return database.ErrInvalidOption
+}
+
+func (s *Store) InsertVote(ctx context.Context, payload database.Vote) (int64, error) {
+	voteID, changed, err := s.insertVote(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	if changed {
+		s.runVoteHooks(ctx, payload)
+	}
+
+	return voteID, nil
+}
+
+func (s *Store) insertVote(payload database.Vote) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.checkPollOpen(payload.PollID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	previous, ok := p.votes[payload.UserID]
+	switch {
+	case !ok:
+		if err := adjustOptionCount(p, payload.Value, 1); err != nil {
+			return 0, false, err
+		}
+
+		s.lastVoteID++
+		p.votes[payload.UserID] = &vote{
+			id:        s.lastVoteID,
+			value:     payload.Value,
+			createdAt: s.now(),
+		}
+		p.VotesCount++
+
+		return s.lastVoteID, true, nil
+	case p.LockVotes:
+		return 0, false, database.ErrVoteLocked
+	case previous.value == payload.Value:
+		return previous.id, false, nil
+	default:
+		if err := adjustOptionCount(p, payload.Value, 1); err != nil {
+			return 0, false, err
+		}
+
+		if err := adjustOptionCount(p, previous.value, -1); err != nil {
+			return 0, false, err
+		}
+
+		now := s.now()
+		previous.value = payload.Value
+		previous.updatedAt = &now
+
+		return previous.id, true, nil
+	}
+}
+
+func (s *Store) DeleteVote(ctx context.Context, pollID int64, userID string) error {
+	value, err := s.deleteVote(pollID, userID)
+	if err != nil {
+		return err
+	}
+
+	s.runVoteHooks(ctx, database.Vote{PollID: pollID, UserID: userID, Value: value})
+
+	return nil
+}
+
+func (s *Store) deleteVote(pollID int64, userID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.checkPollOpen(pollID)
+	if err != nil {
+		return "", err
+	}
+
+	if p.LockVotes {
+		return "", database.ErrVoteLocked
+	}
+
+	previous, ok := p.votes[userID]
+	if !ok {
+		return "", errNotFound
+	}
+
+	if err := adjustOptionCount(p, previous.value, -1); err != nil {
+		return "", err
+	}
+
+	delete(p.votes, userID)
+	p.VotesCount--
+
+	return previous.value, nil
+}
+
+func (s *Store) GetPollResults(_ context.Context, pollID int64) (*database.PollResults, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.polls[pollID]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	return s.results(p), nil
+}
+
+func (s *Store) results(p *poll) *database.PollResults {
+	results := &database.PollResults{
+		PollID:  p.ID,
+		Options: make([]database.OptionResult, 0, len(p.Options)),
+	}
+
+	for _, option := range p.Options {
+		result := database.OptionResult{Value: option.Value}
+
+		for _, v := range p.votes {
+			if v.value != option.Value {
+				continue
+			}
+
+			result.Count++
+
+			if results.LastVoteAt == nil || v.createdAt.After(*results.LastVoteAt) {
+				createdAt := v.createdAt
+				results.LastVoteAt = &createdAt
+			}
+		}
+
+		results.Total += result.Count
+		results.Options = append(results.Options, result)
+	}
+
+	results.ComputePercentages()
+
+	return results
+}
+
+func (s *Store) OnVoteCommitted(hook database.VoteHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hooks = append(s.hooks, hook)
+}
+
+// runVoteHooks is called without the lock held, hooks may call the store
+func (s *Store) runVoteHooks(ctx context.Context, vote database.Vote) {
+	s.mu.Lock()
+	hooks := slices.Clone(s.hooks)
+	s.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(ctx, vote)
+	}
+}
+
+func (s *Store) GetUserByOAuthID(_ context.Context, oauthID string) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByOAuthID(oauthID)
+	if user == nil {
+		return nil, errNotFound
+	}
+
+	copied := *user
+	return &copied, nil
+}
+
+func (s *Store) UpsertUser(_ context.Context, payload database.User) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := s.userByOAuthID(payload.OAuthID)
+	if user == nil {
+		s.lastUserID++
+		user = &database.User{
+			ID:      s.lastUserID,
+			OAuthID: payload.OAuthID,
+		}
+		s.users[user.ID] = user
+	}
+
+	user.Email = payload.Email
+	user.FirstName = payload.FirstName
+	user.LastName = payload.LastName
+
+	copied := *user
+	return &copied, nil
+}
+
+func (s *Store) userByOAuthID(oauthID string) *database.User {
+	for _, user := range s.users {
+		if user.OAuthID == oauthID {
+			return user
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) InsertPersonalAccessToken(_ context.Context, payload database.PersonalAccessToken, tokenHash string) (*database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastTokenID++
+	payload.ID = s.lastTokenID
+	payload.CreatedAt = s.now()
+	payload.Scopes = slices.Clone(payload.Scopes)
+
+	s.tokens[payload.ID] = &token{
+		PersonalAccessToken: payload,
+		hash:                tokenHash,
+	}
+
+	return &payload, nil
+}
+
+func (s *Store) GetPersonalAccessTokensByUserID(_ context.Context, userID int) ([]database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := []database.PersonalAccessToken{}
+	for _, t := range s.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t.PersonalAccessToken)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].ID > tokens[j].ID
+		}
+
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	return tokens, nil
+}
+
+func (s *Store) GetPersonalAccessTokenByHash(_ context.Context, tokenHash string) (*database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.hash != tokenHash {
+			continue
+		}
+
+		user, ok := s.users[t.UserID]
+		if !ok {
+			return nil, errNotFound
+		}
+
+		found := t.PersonalAccessToken
+		found.OAuthID = user.OAuthID
+
+		return &found, nil
+	}
+
+	return nil, errNotFound
+}
+
+func (s *Store) TouchPersonalAccessToken(_ context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[id]; ok {
+		now := s.now()
+		t.LastUsedAt = &now
+	}
+
+	return nil
+}
+
+func (s *Store) DeletePersonalAccessTokenByIDAndUserID(_ context.Context, id, userID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok || t.UserID != userID {
+		return 0, nil
+	}
+
+	delete(s.tokens, id)
+
+	return 1, nil
+}
+
+// sortedPolls returns the polls by ID, the lock must be held
+func (s *Store) sortedPolls() []*poll {
+	polls := make([]*poll, 0, len(s.polls))
+	for _, p := range s.polls {
+		polls = append(polls, p)
+	}
+
+	sort.Slice(polls, func(i, j int) bool {
+		return polls[i].ID < polls[j].ID
+	})
+
+	return polls
+}
+
+func (s *Store) GetTicker(_ context.Context, symbol string) (database.Ticker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ticker, ok := s.tickers[symbol]
+	if !ok {
+		return database.Ticker{}, errNotFound
+	}
+
+	return ticker, nil
+}
+
+// SearchTickers mirrors the ordering of the postgres autocomplete
+func (s *Store) SearchTickers(_ context.Context, prefix string, limit int) ([]database.Ticker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol := ticker.Normalize(prefix)
+	name := strings.ToLower(prefix)
+
+	// rank is 0 for the exact symbol, 1 for symbol prefixes and 2 for names
+	rank := func(ticker database.Ticker) int {
+		switch {
+		case ticker.Symbol == symbol:
+			return 0
+		case strings.HasPrefix(ticker.Symbol, symbol):
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	tickers := []database.Ticker{}
+	for _, ticker := range s.tickers {
+		if strings.HasPrefix(ticker.Symbol, symbol) || strings.HasPrefix(strings.ToLower(ticker.Name), name) {
+			tickers = append(tickers, ticker)
+		}
+	}
+
+	sort.Slice(tickers, func(i, j int) bool {
+		if ri, rj := rank(tickers[i]), rank(tickers[j]); ri != rj {
+			return ri < rj
+		}
+
+		return tickers[i].Symbol < tickers[j].Symbol
+	})
+
+	if len(tickers) > max(limit, 1) {
+		tickers = tickers[:max(limit, 1)]
+	}
+
+	return tickers, nil
+}
+
+func (s *Store) UpsertTickers(_ context.Context, tickers []database.Ticker) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ticker := range tickers {
+		s.tickers[ticker.Symbol] = ticker
+	}
+
+	return len(tickers), nil
+}
+
+// GetTickerSentiment counts the votes directly, there is nothing to materialize in memory
+func (s *Store) GetTickerSentiment(_ context.Context, symbol string) (database.TickerSentiment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	hour := now.Truncate(time.Hour)
+
+	sentiment := database.TickerSentiment{
+		Symbol:      symbol,
+		Windows:     make([]database.WindowSentiment, len(database.SentimentWindows)),
+		RefreshedAt: &now,
+	}
+
+	for i, window := range database.SentimentWindows {
+		result := database.WindowSentiment{Window: window.Name}
+		since := hour.Add(-time.Duration(window.Hours-1) * time.Hour)
+
+		for _, p := range s.polls {
+			if p.Ticker != symbol {
+				continue
+			}
+
+			for _, v := range p.votes {
+				if v.createdAt.Before(since) {
+					continue
+				}
+
+				switch optionSentiment(p, v.value) {
+				case 1:
+					result.Bullish++
+				case -1:
+					result.Bearish++
+				default:
+					result.Neutral++
+				}
+			}
+		}
+
+		result.ComputeIndex()
+		sentiment.Windows[i] = result
+	}
+
+	return sentiment, nil
+}
+
+// optionSentiment is the sentiment of the option voted for
+func optionSentiment(p *poll, value string) int {
+	for _, option := range p.Options {
+		if option.Value == value {
+			return option.Sentiment
+		}
+	}
+
+	return 0
+}
+
+func (s *Store) RefreshSentiment(context.Context, bool) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,3 @@
+drop table if exists public.votes;
+drop table if exists public.polls;
+drop table if exists public.users;
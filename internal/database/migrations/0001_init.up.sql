@@ -0,0 +1,66 @@
+-- adopts databases created before migrations existed, hence the `if not exists`
+create table if not exists public.users
+(
+    id         serial
+        constraint users_pk_2
+            primary key,
+    oauth_id   text not null
+        constraint users_pk
+            unique,
+    email      text not null
+        constraint users_pk_3
+            unique,
+    first_name text not null,
+    last_name  text not null
+);
+
+create index if not exists users_oauth_id_index
+    on public.users (oauth_id);
+
+create table if not exists public.polls
+(
+    id           serial
+        constraint polls_pk
+            primary key,
+    author_email text    default null,
+    user_id      integer default null
+        constraint polls_users_id_fk
+            references public.users
+            on delete set null,
+    description  text    default null,
+    title        text       not null,
+    ticker       varchar(5) not null,
+    votes_count  integer default 0,
+    created_at   timestamp default now()
+);
+
+create index if not exists polls_author_email_index
+    on public.polls (author_email)
+    where user_id is null;
+
+create index if not exists polls_user_id_index
+    on public.polls (user_id);
+
+alter table public.polls
+    add column if not exists created_at timestamp default now();
+
+alter table public.polls
+    add column if not exists votes_count integer default 0;
+
+create table if not exists public.votes
+(
+    id         serial
+        constraint votes_pk
+            primary key,
+    poll_id    serial not null
+        constraint votes_polls_id_fk
+            references public.polls,
+    user_id    text   not null,
+    value      varchar(1),
+    created_at timestamp default now(),
+    constraint votes_pk_2
+        unique (poll_id, user_id)
+);
+
+alter table public.votes
+    add column if not exists created_at timestamp default now();
@@ -0,0 +1,21 @@
+create table if not exists public.personal_access_tokens
+(
+    id           serial
+        constraint personal_access_tokens_pk
+            primary key,
+    user_id      integer not null
+        constraint personal_access_tokens_users_id_fk
+            references public.users
+            on delete cascade,
+    name         text    not null,
+    token_hash   text    not null
+        constraint personal_access_tokens_token_hash_uk
+            unique,
+    scopes       text[]  not null default '{}',
+    expires_at   timestamp default null,
+    last_used_at timestamp default null,
+    created_at   timestamp default now()
+);
+
+create index if not exists personal_access_tokens_user_id_index
+    on public.personal_access_tokens (user_id);
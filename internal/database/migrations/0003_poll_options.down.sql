@@ -0,0 +1,5 @@
+drop table if exists public.poll_options;
+
+-- fails if a vote no longer fits, the value column was only widened for options
+alter table public.votes
+    alter column value type varchar(1);
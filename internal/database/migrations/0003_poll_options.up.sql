@@ -0,0 +1,29 @@
+alter table public.votes
+    alter column value type text;
+
+create table if not exists public.poll_options
+(
+    id          serial
+        constraint poll_options_pk
+            primary key,
+    poll_id     integer not null
+        constraint poll_options_polls_id_fk
+            references public.polls
+            on delete cascade,
+    position    integer not null,
+    value       text    not null,
+    votes_count integer default 0,
+    constraint poll_options_poll_id_value_uk
+        unique (poll_id, value)
+);
+
+create index if not exists poll_options_poll_id_index
+    on public.poll_options (poll_id, position);
+
+-- polls created before options existed get one option per cast value
+insert into public.poll_options (poll_id, position, value, votes_count)
+select poll_id, row_number() over (partition by poll_id order by value) - 1, value, count(*)
+from public.votes v
+where value is not null
+  and not exists (select 1 from public.poll_options o where o.poll_id = v.poll_id)
+group by poll_id, value;
@@ -0,0 +1,8 @@
+drop index if exists public.polls_closes_at_index;
+
+alter table public.polls
+    drop column if exists final_results,
+    drop column if exists finalized_at,
+    drop column if exists closes_at,
+    drop column if exists opens_at,
+    drop column if exists draft;
@@ -0,0 +1,24 @@
+alter table public.polls
+    add column if not exists draft boolean not null default false;
+
+alter table public.polls
+    add column if not exists opens_at timestamp;
+
+update public.polls set opens_at = coalesce(created_at, now()) where opens_at is null;
+
+alter table public.polls
+    alter column opens_at set default now(),
+    alter column opens_at set not null;
+
+alter table public.polls
+    add column if not exists closes_at timestamp default null;
+
+alter table public.polls
+    add column if not exists finalized_at timestamp default null;
+
+alter table public.polls
+    add column if not exists final_results jsonb default null;
+
+create index if not exists polls_closes_at_index
+    on public.polls (closes_at)
+    where finalized_at is null;
@@ -0,0 +1,5 @@
+alter table public.votes
+    drop column if exists updated_at;
+
+alter table public.polls
+    drop column if exists lock_votes;
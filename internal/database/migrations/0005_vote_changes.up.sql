@@ -0,0 +1,5 @@
+alter table public.polls
+    add column if not exists lock_votes boolean not null default false;
+
+alter table public.votes
+    add column if not exists updated_at timestamp default null;
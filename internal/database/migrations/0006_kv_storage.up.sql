@@ -0,0 +1,12 @@
+create table if not exists public.kv_storage
+(
+    db         integer not null,
+    key        text    not null,
+    value      bytea   not null,
+    expires_at timestamp default null,
+    constraint kv_storage_pk
+        primary key (db, key)
+);
+
+create index if not exists kv_storage_expires_at_index
+    on public.kv_storage (expires_at);
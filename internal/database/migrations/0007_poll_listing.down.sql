@@ -0,0 +1,5 @@
+drop index if exists public.polls_ticker_index;
+
+drop index if exists public.polls_votes_count_index;
+
+drop index if exists public.polls_created_at_id_index;
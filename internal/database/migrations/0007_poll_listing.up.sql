@@ -0,0 +1,9 @@
+-- keyset pagination of the listings, see ListPolls
+create index if not exists polls_created_at_id_index
+    on public.polls (created_at desc, id desc);
+
+create index if not exists polls_votes_count_index
+    on public.polls (votes_count desc, created_at desc, id desc);
+
+create index if not exists polls_ticker_index
+    on public.polls (ticker);
@@ -0,0 +1,4 @@
+drop index if exists public.polls_search_index;
+
+alter table public.polls
+    drop column if exists search;
@@ -0,0 +1,10 @@
+-- full-text search, see SearchPolls
+alter table public.polls
+    add column if not exists search tsvector
+        generated always as (
+            setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+            setweight(to_tsvector('english', coalesce(description, '')), 'B')
+        ) stored;
+
+create index if not exists polls_search_index
+    on public.polls using gin (search);
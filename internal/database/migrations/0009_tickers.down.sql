@@ -0,0 +1,5 @@
+-- symbols longer than 5 characters are truncated
+alter table public.polls
+    alter column ticker type varchar(5) using left(ticker, 5);
+
+drop table if exists public.tickers;
@@ -0,0 +1,22 @@
+create table if not exists public.tickers
+(
+    symbol      varchar(12) not null
+        constraint tickers_pk
+            primary key,
+    name        text        not null,
+    exchange    text        not null,
+    asset_class text        not null,
+    updated_at  timestamp   not null default now()
+);
+
+-- prefix lookups of SearchTickers
+create index if not exists tickers_symbol_pattern_index
+    on public.tickers (symbol varchar_pattern_ops);
+
+create index if not exists tickers_name_pattern_index
+    on public.tickers (lower(name) text_pattern_ops);
+
+alter table public.polls
+    alter column ticker type varchar(12);
+
+update public.polls set ticker = upper(trim(ticker)) where ticker <> upper(trim(ticker));
@@ -0,0 +1,10 @@
+drop index if exists public.votes_updated_at_index;
+
+drop index if exists public.votes_created_at_index;
+
+drop table if exists public.ticker_sentiment_state;
+
+drop table if exists public.ticker_sentiment;
+
+alter table public.poll_options
+    drop column if exists sentiment;
@@ -0,0 +1,40 @@
+-- direction of an option, 1 bullish, -1 bearish, 0 neutral, see OptionSentiment
+alter table public.poll_options
+    add column if not exists sentiment smallint not null default 0;
+
+update public.poll_options
+set sentiment = case
+    when lower(substring(value from '[[:alpha:]]+')) in ('bull', 'bullish', 'buy', 'long', 'up', 'higher', 'rise', 'calls') then 1
+    when lower(substring(value from '[[:alpha:]]+')) in ('bear', 'bearish', 'sell', 'short', 'down', 'lower', 'fall', 'puts') then -1
+    else 0
+end;
+
+-- hourly vote counts per ticker, maintained by RefreshSentiment
+create table if not exists public.ticker_sentiment
+(
+    ticker  varchar(12) not null,
+    bucket  timestamp   not null,
+    bullish integer     not null default 0,
+    bearish integer     not null default 0,
+    neutral integer     not null default 0,
+    constraint ticker_sentiment_pk
+        primary key (ticker, bucket)
+);
+
+-- single row holding the high-water mark of the last refresh
+create table if not exists public.ticker_sentiment_state
+(
+    id           boolean   not null default true
+        constraint ticker_sentiment_state_pk
+            primary key
+        constraint ticker_sentiment_state_single_row
+            check (id),
+    refreshed_at timestamp not null
+);
+
+create index if not exists votes_created_at_index
+    on public.votes (created_at);
+
+create index if not exists votes_updated_at_index
+    on public.votes (updated_at)
+    where updated_at is not null;
@@ -0,0 +1,8 @@
+drop index if exists public.polls_unresolved_index;
+
+alter table public.polls
+    drop column if exists outcome,
+    drop column if exists resolved_at,
+    drop column if exists resolution_target,
+    drop column if exists resolution_operator,
+    drop column if exists reference_price;
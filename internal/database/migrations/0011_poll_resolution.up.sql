@@ -0,0 +1,20 @@
+alter table public.polls
+    add column if not exists reference_price numeric default null;
+
+alter table public.polls
+    add column if not exists resolution_operator text default null
+        constraint polls_resolution_operator_check
+            check (resolution_operator in ('above', 'below'));
+
+alter table public.polls
+    add column if not exists resolution_target numeric default null;
+
+alter table public.polls
+    add column if not exists resolved_at timestamp default null;
+
+alter table public.polls
+    add column if not exists outcome jsonb default null;
+
+create index if not exists polls_unresolved_index
+    on public.polls (closes_at)
+    where resolution_operator is not null and resolved_at is null;
@@ -0,0 +1,6 @@
+alter table public.polls
+    alter column created_at type timestamp,
+    alter column resolved_at type timestamp,
+    alter column finalized_at type timestamp,
+    alter column closes_at type timestamp using closes_at at time zone 'UTC',
+    alter column opens_at type timestamp using opens_at at time zone 'UTC';
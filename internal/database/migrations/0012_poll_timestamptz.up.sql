@@ -0,0 +1,8 @@
+-- opens_at and closes_at were written as UTC by the API (or defaulted with now()),
+-- the other columns were defaulted with now() in the session time zone
+alter table public.polls
+    alter column opens_at type timestamptz using opens_at at time zone 'UTC',
+    alter column closes_at type timestamptz using closes_at at time zone 'UTC',
+    alter column finalized_at type timestamptz,
+    alter column resolved_at type timestamptz,
+    alter column created_at type timestamptz;
@@ -0,0 +1,2 @@
+alter table public.polls
+    drop constraint if exists polls_schedule_check;
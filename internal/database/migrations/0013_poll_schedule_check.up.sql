@@ -0,0 +1,4 @@
+-- not valid skips the check of existing rows, new writes are checked
+alter table public.polls
+    add constraint polls_schedule_check
+        check (closes_at is null or closes_at > opens_at) not valid;
@@ -0,0 +1,6 @@
+alter table public.poll_options
+    drop constraint if exists poll_options_sentiment_check;
+
+drop table if exists public.ticker_sentiment_retracted;
+
+comment on column public.poll_options.sentiment is null;
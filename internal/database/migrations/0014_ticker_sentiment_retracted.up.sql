@@ -0,0 +1,17 @@
+-- option sentiments are now set by the poll author, the values 0010 derived
+-- from option keywords are kept as if authored, 0015 derives winners from them
+comment on column public.poll_options.sentiment is
+    'direction of the option set by the poll author, 1 bullish, -1 bearish, 0 neutral';
+
+-- buckets that lost a vote since the last refresh, recounted by RefreshSentiment
+create table if not exists public.ticker_sentiment_retracted
+(
+    ticker varchar(12) not null,
+    bucket timestamp   not null,
+    constraint ticker_sentiment_retracted_pk
+        primary key (ticker, bucket)
+);
+
+alter table public.poll_options
+    add constraint poll_options_sentiment_check
+        check (sentiment between -1 and 1) not valid;
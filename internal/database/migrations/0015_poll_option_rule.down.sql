@@ -0,0 +1,2 @@
+alter table public.poll_options
+    drop column if exists meets_rule;
@@ -0,0 +1,11 @@
+-- options winning when the resolution rule is met, set by the poll author
+alter table public.poll_options
+    add column if not exists meets_rule boolean not null default false;
+
+-- polls created before the flag keep the winners derived from the option sentiment
+update public.poll_options o
+set meets_rule = (p.resolution_operator = 'above' and o.sentiment > 0)
+              or (p.resolution_operator = 'below' and o.sentiment < 0)
+from public.polls p
+where p.id = o.poll_id
+  and p.resolution_operator is not null;
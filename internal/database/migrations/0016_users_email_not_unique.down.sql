@@ -0,0 +1,6 @@
+drop index if exists public.users_email_index;
+
+-- fails while several users share an email
+alter table public.users
+    add constraint users_pk_3
+        unique (email);
@@ -0,0 +1,7 @@
+-- a user signing in with a second provider gets a user per provider,
+-- both with the same verified email
+alter table public.users
+    drop constraint if exists users_pk_3;
+
+create index if not exists users_email_index
+    on public.users (email);
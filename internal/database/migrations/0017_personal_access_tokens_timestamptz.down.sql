@@ -0,0 +1,4 @@
+alter table public.personal_access_tokens
+    alter column created_at type timestamp,
+    alter column last_used_at type timestamp,
+    alter column expires_at type timestamp using expires_at at time zone 'UTC';
@@ -0,0 +1,7 @@
+-- expires_at was written with the offset of the client dropped, the original
+-- offset is lost so it is read as UTC; the other columns were defaulted with now()
+-- in the session time zone
+alter table public.personal_access_tokens
+    alter column expires_at type timestamptz using expires_at at time zone 'UTC',
+    alter column last_used_at type timestamptz,
+    alter column created_at type timestamptz;
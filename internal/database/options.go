@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+var ErrInvalidOption = &Error{Kind: ErrValidation, Message: "value is not a valid option for this poll"}
+
+type PollOption struct {
+	ID         int64  `json:"id"`
+	PollID     int64  `json:"-"`
+	Position   int    `json:"position"`
+	Value      string `json:"value"`
+	VotesCount int    `json:"votes_count"`
+	// Sentiment is set by the author, 1 bullish, -1 bearish and 0 neutral
+	Sentiment int `json:"sentiment"`
+	// MeetsRule options win when the resolution rule is met, the others when it is not
+	MeetsRule bool `json:"meets_rule"`
+}
+
+// insertPollOptions inserts the options in the given order
+func insertPollOptions(ctx context.Context, tx *sql.Tx, pollID int64, payload []PollOption) ([]PollOption, error) {
+	options := make([]PollOption, 0, len(payload))
+
+	for position, option := range payload {
+		option.PollID, option.Position, option.VotesCount = pollID, position, 0
+
+		if err := tx.QueryRowContext(
+			ctx,
+			"INSERT INTO poll_options (poll_id, position, value, sentiment, meets_rule) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			pollID,
+			position,
+			option.Value,
+			option.Sentiment,
+			option.MeetsRule,
+		).Scan(&option.ID); err != nil {
+			return nil, err
+		}
+
+		options = append(options, option)
+	}
+
+	return options, nil
+}
+
+// GetPollOptions gets the options of a poll with their tallies, in order
+func GetPollOptions(ctx context.Context, pollID int64) ([]PollOption, error) {
+	rows, err := database.QueryContext(
+		ctx,
+		`
+		SELECT id, poll_id, position, value, votes_count, sentiment, meets_rule
+		FROM poll_options
+		WHERE poll_id = $1
+		ORDER BY position
+		`,
+		pollID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []PollOption{}
+	for rows.Next() {
+		var option PollOption
+		if err := rows.Scan(&option.ID, &option.PollID, &option.Position, &option.Value, &option.VotesCount, &option.Sentiment, &option.MeetsRule); err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+
+	return options, rows.Err()
+}
@@ -2,79 +2,181 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 )
 
+type PollStatus string
+
+const (
+	PollStatusDraft     PollStatus = "draft"
+	PollStatusScheduled PollStatus = "scheduled"
+	PollStatusOpen      PollStatus = "open"
+	PollStatusClosed    PollStatus = "closed"
+)
+
+var (
+	ErrPollNotOpen  = &Error{Kind: ErrConflict, Message: "poll is not open for voting yet"}
+	ErrPollClosed   = &Error{Kind: ErrConflict, Message: "poll is closed"}
+	ErrNotPollOwner = &Error{Kind: ErrForbidden, Message: "poll belongs to another user"}
+)
+
 type Poll struct {
-	ID          int64     `json:"id"`
-	Title       string    `json:"title"`
-	Description *string   `json:"description"`
-	Ticker      string    `json:"ticker"`
-	AuthorEmail *string   `json:"author_email,omitempty"`
-	UserID      *int      `json:"user_id,omitempty"`
-	VotesCount  int       `json:"votes_count,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
-}
-
-func createPollsTable() error {
-	return execute(`
-create table if not exists public.polls
-(
-    id           serial
-        constraint polls_pk
-            primary key,
-    author_email text    default null,
-    user_id      integer default null
-        constraint polls_users_id_fk
-            references public.users
-            on delete set null,
-    description  text    default null,
-    title        text       not null,
-    ticker        varchar(5) not null,
-    votes_count  integer default 0,
-    created_at timestamp default now()
-);
-
-create index if not exists polls_author_email_index
-    on public.polls (author_email)
-    where user_id is null;
-
-create index if not exists polls_user_id_index
-    on public.polls (user_id);
-
-alter table public.polls 
-		add column if not exists created_at timestamp default now();
-
-alter table public.polls 
-		add column if not exists votes_count integer default 0;
-`)
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Description *string    `json:"description"`
+	Ticker      string     `json:"ticker"`
+	AuthorEmail *string    `json:"author_email,omitempty"`
+	UserID      *int       `json:"user_id,omitempty"`
+	VotesCount  int        `json:"votes_count,omitempty"`
+	Draft       bool       `json:"-"`
+	LockVotes   bool       `json:"lock_votes"`
+	OpensAt     *time.Time `json:"opens_at"`
+	ClosesAt    *time.Time `json:"closes_at"`
+	Status      PollStatus `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	// ReferencePrice is the price of the ticker when the poll was created
+	ReferencePrice *float64    `json:"reference_price,omitempty"`
+	Resolution     *Resolution `json:"resolution,omitempty"`
+	Outcome        *Outcome    `json:"outcome,omitempty"`
+
+	Options []PollOption `json:"options,omitempty"`
+}
+
+// pollStatusSQL derives the status on the database clock
+const pollStatusSQL = `CASE
+		WHEN draft THEN 'draft'
+		WHEN now() < opens_at THEN 'scheduled'
+		WHEN closes_at IS NOT NULL AND now() >= closes_at THEN 'closed'
+		ELSE 'open'
+	END`
+
+// StatusAt derives the status at the given time, like pollStatusSQL
+func (p Poll) StatusAt(now time.Time) PollStatus {
+	switch {
+	case p.Draft:
+		return PollStatusDraft
+	case p.OpensAt != nil && now.Before(*p.OpensAt):
+		return PollStatusScheduled
+	case p.ClosesAt != nil && !now.Before(*p.ClosesAt):
+		return PollStatusClosed
+	default:
+		return PollStatusOpen
+	}
 }
 
+// pollColumns are the columns read by scanPoll, in order
+const pollColumns = "id, title, description, ticker, author_email, user_id, votes_count, draft, lock_votes, opens_at, closes_at, " + pollStatusSQL + ", created_at, " +
+	"reference_price, resolution_operator, resolution_target, outcome"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPoll(row scanner) (Poll, error) {
+	var (
+		poll     Poll
+		operator sql.NullString
+		target   sql.NullFloat64
+		outcome  []byte
+	)
+
+	err := row.Scan(
+		&poll.ID,
+		&poll.Title,
+		&poll.Description,
+		&poll.Ticker,
+		&poll.AuthorEmail,
+		&poll.UserID,
+		&poll.VotesCount,
+		&poll.Draft,
+		&poll.LockVotes,
+		&poll.OpensAt,
+		&poll.ClosesAt,
+		&poll.Status,
+		&poll.CreatedAt,
+		&poll.ReferencePrice,
+		&operator,
+		&target,
+		&outcome,
+	)
+	if err != nil {
+		return poll, err
+	}
+
+	if operator.Valid {
+		poll.Resolution = &Resolution{Operator: operator.String, Target: target.Float64}
+	}
+
+	if outcome != nil {
+		poll.Outcome = &Outcome{}
+		if err := json.Unmarshal(outcome, poll.Outcome); err != nil {
+			return poll, err
+		}
+	}
+
+	return poll, nil
+}
+
+// InsertPoll inserts the poll and its options atomically,
+// returns the ID of the poll
 func InsertPoll(ctx context.Context, payload Poll) (int64, error) {
-	result, err := database.ExecContext(
-		ctx,
-		`
+	var (
+		pollID   int64
+		operator *string
+		target   *float64
+	)
+
+	if payload.Resolution != nil {
+		operator, target = &payload.Resolution.Operator, &payload.Resolution.Target
+	}
+
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(
+			ctx,
+			`
     INSERT INTO polls 
-    (title, description, ticker, author_email, user_id)
+    (title, description, ticker, author_email, user_id, draft, lock_votes, opens_at, closes_at, reference_price, resolution_operator, resolution_target)
     VALUES
-    ($1, $2, $3, $4, $5)
+    ($1, $2, $3, $4, $5, $6, $7, coalesce($8, now()), $9, $10, $11, $12)
     RETURNING id
     `,
-		payload.Title,
-		payload.Description,
-		payload.Ticker,
-		payload.AuthorEmail,
-		payload.UserID,
-	)
+			payload.Title,
+			payload.Description,
+			payload.Ticker,
+			payload.AuthorEmail,
+			payload.UserID,
+			payload.Draft,
+			payload.LockVotes,
+			payload.OpensAt,
+			payload.ClosesAt,
+			payload.ReferencePrice,
+			operator,
+			target,
+		).Scan(&pollID); err != nil {
+			return err
+		}
+
+		if _, err := insertPollOptions(ctx, tx, pollID, payload.Options); err != nil {
+			log.Error().Err(err).Int64("poll_id", pollID).Msg("Failed to insert poll options")
+			return err
+		}
+
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	log.Debug().Interface("result", result).Send()
-
-	return result.RowsAffected()
+	return pollID, nil
 }
 
 func IncrementPollVotesCount(ctx context.Context, pollID int64) (int64, error) {
@@ -86,38 +188,191 @@ func IncrementPollVotesCount(ctx context.Context, pollID int64) (int64, error) {
 	return result.RowsAffected()
 }
 
-func GetPollsByUserID(ctx context.Context, userID int) ([]Poll, error) {
-	rows, err := database.QueryContext(ctx, "SELECT id, title, description, ticker, author_email, user_id, created_at FROM polls WHERE user_id = $1", userID)
+// PollFilter selects the polls of a listing, zero fields match every poll
+type PollFilter struct {
+	UserID *int
+	// Public hides drafts
+	Public        bool
+	Ticker        string
+	Status        PollStatus
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          PollSort
+	After         *PollCursor
+	Limit         int
+}
+
+// PollPage is a page of a listing, Next is nil on the last page
+type PollPage struct {
+	Polls []Poll
+	Next  *PollCursor
+}
+
+// Paginate turns up to filter.Limit+1 sorted polls into a page
+func Paginate(polls []Poll, filter PollFilter) PollPage {
+	page := PollPage{Polls: polls}
+	if page.Polls == nil {
+		page.Polls = []Poll{}
+	}
+
+	if len(polls) > filter.Limit {
+		page.Polls = polls[:filter.Limit]
+		page.Next = cursorAfter(page.Polls[filter.Limit-1], filter.Sort)
+	}
+
+	return page
+}
+
+// ListPolls returns a page of the polls matching the filter,
+// keyset paginated over created_at and id
+func ListPolls(ctx context.Context, filter PollFilter) (PollPage, error) {
+	filter.Limit = max(filter.Limit, 1)
+
+	var (
+		conditions []string
+		args       []any
+	)
+
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.UserID != nil {
+		conditions = append(conditions, "user_id = "+arg(*filter.UserID))
+	}
+
+	if filter.Public {
+		conditions = append(conditions, "NOT draft")
+	}
+
+	if filter.Ticker != "" {
+		conditions = append(conditions, "ticker = "+arg(filter.Ticker))
+	}
+
+	if filter.Status != "" {
+		conditions = append(conditions, pollStatusSQL+" = "+arg(filter.Status))
+	}
+
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.CreatedAfter))
+	}
+
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.CreatedBefore))
+	}
+
+	order := "created_at DESC, id DESC"
+	if filter.Sort == PollSortVotes {
+		order = "votes_count DESC, " + order
+	}
+
+	if after := filter.After; after != nil {
+		if filter.Sort == PollSortVotes {
+			conditions = append(conditions, "(votes_count, created_at, id) < ("+arg(after.VotesCount)+", "+arg(after.CreatedAt)+", "+arg(after.ID)+")")
+		} else {
+			conditions = append(conditions, "(created_at, id) < ("+arg(after.CreatedAt)+", "+arg(after.ID)+")")
+		}
+	}
+
+	query := "SELECT " + pollColumns + " FROM polls"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + order + " LIMIT " + arg(filter.Limit+1)
+
+	rows, err := database.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return PollPage{}, err
 	}
 	defer rows.Close()
 
 	var polls []Poll
 	for rows.Next() {
-		var poll Poll
-		if err := rows.Scan(&poll.ID, &poll.Title, &poll.Description, &poll.Ticker, &poll.AuthorEmail, &poll.UserID, &poll.CreatedAt); err != nil {
-			return nil, err
+		poll, err := scanPoll(rows)
+		if err != nil {
+			return PollPage{}, err
 		}
 		polls = append(polls, poll)
 	}
 
-	return polls, nil
+	if err := rows.Err(); err != nil {
+		return PollPage{}, err
+	}
+
+	return Paginate(polls, filter), nil
+}
+
+// searchHeadlineOptions configures the snippets of SearchPolls
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20"
+
+// searchSnippetText is the text of the snippets, escaped like html.EscapeString
+// so the <mark> tags added by ts_headline are the only markup
+const searchSnippetText = `replace(replace(replace(replace(replace(
+			title || coalesce(' ' || description, ''),
+			'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+// SearchPolls finds the published polls matching every word of the query as a prefix,
+// or whose ticker is one of its words, best matches first
+func SearchPolls(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	rows, err := database.QueryContext(
+		ctx,
+		`
+		WITH query AS (SELECT to_tsquery('english', $1) AS q)
+		SELECT `+pollColumns+`,
+			ts_rank(search, q) + CASE WHEN ticker = ANY($2) THEN 1 ELSE 0 END AS rank,
+			ts_headline('english', `+searchSnippetText+`, q, '`+searchHeadlineOptions+`')
+		FROM polls, query
+		WHERE NOT draft AND (search @@ q OR ticker = ANY($2))
+		ORDER BY rank DESC, created_at DESC, id DESC
+		LIMIT $3
+		`,
+		prefixQuery(SearchTerms(query)),
+		pq.Array(SearchSymbols(query)),
+		max(limit, 1),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+
+		poll, err := scanPoll(extraScanner{rows, []any{&result.Rank, &result.Snippet}})
+		if err != nil {
+			return nil, err
+		}
+
+		result.Poll = poll
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
 }
 
+// GetPollByID gets a poll with its options and their tallies
 func GetPollByID(ctx context.Context, id int64) (Poll, error) {
-	row := database.QueryRowContext(ctx, "SELECT id, title, description, ticker, author_email, user_id, created_at FROM polls WHERE id = $1", id)
+	row := database.QueryRowContext(ctx, "SELECT "+pollColumns+" FROM polls WHERE id = $1", id)
 
-	var poll Poll
-	if err := row.Scan(&poll.ID, &poll.Title, &poll.Description, &poll.Ticker, &poll.AuthorEmail, &poll.UserID, &poll.CreatedAt); err != nil {
+	poll, err := scanPoll(row)
+	if err != nil {
 		return poll, err
 	}
 
+	options, err := GetPollOptions(ctx, poll.ID)
+	if err != nil {
+		return poll, err
+	}
+
+	poll.Options = options
+
 	return poll, nil
 }
 
 func GetPollsByAuthorEmail(ctx context.Context, email string) ([]Poll, error) {
-	rows, err := database.QueryContext(ctx, "SELECT * FROM polls WHERE author_email = $1", email)
+	rows, err := database.QueryContext(ctx, "SELECT "+pollColumns+" FROM polls WHERE author_email = $1", email)
 	if err != nil {
 		return nil, err
 	}
@@ -125,8 +380,8 @@ func GetPollsByAuthorEmail(ctx context.Context, email string) ([]Poll, error) {
 
 	var polls []Poll
 	for rows.Next() {
-		var poll Poll
-		if err := rows.Scan(&poll.ID, &poll.Title, &poll.Description, &poll.Ticker, &poll.AuthorEmail, &poll.UserID); err != nil {
+		poll, err := scanPoll(rows)
+		if err != nil {
 			return nil, err
 		}
 		polls = append(polls, poll)
@@ -135,11 +390,219 @@ func GetPollsByAuthorEmail(ctx context.Context, email string) ([]Poll, error) {
 	return polls, nil
 }
 
-func DeletePollByIDAndUserID(ctx context.Context, id, userID int) (int64, error) {
-	result, err := database.ExecContext(ctx, "DELETE FROM polls WHERE id = $1 AND user_id = $2", id, userID)
+// ScheduleUpdate changes the lifecycle fields of a poll, nil fields are left untouched
+type ScheduleUpdate struct {
+	Draft    *bool
+	OpensAt  *time.Time
+	ClosesAt *time.Time
+	// ClearClosesAt keeps the poll open indefinitely
+	ClearClosesAt bool
+}
+
+// Apply returns the schedule after the update,
+// fails unless closes_at stays after opens_at and resolvable polls keep closing
+func (u ScheduleUpdate) Apply(opensAt time.Time, closesAt *time.Time, resolvable bool) (time.Time, *time.Time, error) {
+	if u.OpensAt != nil {
+		opensAt = *u.OpensAt
+	}
+
+	switch {
+	case u.ClearClosesAt:
+		closesAt = nil
+	case u.ClosesAt != nil:
+		closesAt = u.ClosesAt
+	}
+
+	if closesAt == nil && resolvable {
+		return opensAt, closesAt, ErrResolutionNeedsClose
+	}
+
+	if closesAt != nil && !closesAt.After(opensAt) {
+		return opensAt, closesAt, ErrInvalidSchedule
+	}
+
+	return opensAt, closesAt, nil
+}
+
+var (
+	ErrInvalidSchedule      = &Error{Kind: ErrValidation, Message: "closes_at must be after opens_at"}
+	ErrResolutionNeedsClose = &Error{Kind: ErrValidation, Message: "closes_at is required to resolve the poll"}
+)
+
+// UpdatePollSchedule updates the lifecycle fields of a poll owned by the user,
+// the resulting schedule is checked against the stored one.
+// Fails with ErrNotPollOwner when the poll belongs to another user
+func UpdatePollSchedule(ctx context.Context, id, userID int, update ScheduleUpdate) (int64, error) {
+	var updated int64
+
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		var (
+			owner      sql.NullInt64
+			opensAt    time.Time
+			closesAt   *time.Time
+			resolvable bool
+		)
+
+		err := tx.QueryRowContext(
+			ctx,
+			"SELECT user_id, opens_at, closes_at, resolution_operator IS NOT NULL FROM polls WHERE id = $1 AND finalized_at IS NULL FOR UPDATE",
+			id,
+		).Scan(&owner, &opensAt, &closesAt, &resolvable)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !owner.Valid || owner.Int64 != int64(userID) {
+			return ErrNotPollOwner
+		}
+
+		opensAt, closesAt, err = update.Apply(opensAt, closesAt, resolvable)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(
+			ctx,
+			"UPDATE polls SET draft = coalesce($2, draft), opens_at = $3, closes_at = $4 WHERE id = $1",
+			id,
+			update.Draft,
+			opensAt,
+			closesAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		updated, err = result.RowsAffected()
+		return err
+	})
+
+	return updated, err
+}
+
+// checkPollOpen locks the poll row and fails unless it accepts votes,
+// reports whether cast votes are locked
+func checkPollOpen(ctx context.Context, tx *sql.Tx, pollID int64) (bool, error) {
+	var (
+		status PollStatus
+		locked bool
+	)
+
+	if err := tx.QueryRowContext(ctx, "SELECT "+pollStatusSQL+", lock_votes FROM polls WHERE id = $1 FOR UPDATE", pollID).Scan(&status, &locked); err != nil {
+		return false, err
+	}
+
+	switch status {
+	case PollStatusOpen:
+		return locked, nil
+	case PollStatusClosed:
+		return locked, ErrPollClosed
+	default:
+		return locked, ErrPollNotOpen
+	}
+}
+
+// FinalizeClosedPolls snapshots the results of the polls
+// that closed since the last run, returns how many were finalized
+func FinalizeClosedPolls(ctx context.Context) (int, error) {
+	rows, err := database.QueryContext(ctx, "SELECT id FROM polls WHERE closes_at <= now() AND finalized_at IS NULL")
 	if err != nil {
 		return 0, err
 	}
 
-	return result.RowsAffected()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	finalized := 0
+	for _, id := range ids {
+		results, err := GetPollResults(ctx, id)
+		if err != nil {
+			return finalized, err
+		}
+
+		snapshot, err := json.Marshal(results)
+		if err != nil {
+			return finalized, err
+		}
+
+		if _, err := database.ExecContext(
+			ctx,
+			"UPDATE polls SET finalized_at = now(), final_results = $2 WHERE id = $1 AND finalized_at IS NULL",
+			id,
+			snapshot,
+		); err != nil {
+			return finalized, err
+		}
+
+		finalized++
+	}
+
+	return finalized, nil
+}
+
+// DeletePollByIDAndUserID deletes a poll owned by the user along with its votes,
+// returns the number of deleted polls.
+// Fails with ErrNotPollOwner when the poll belongs to another user
+func DeletePollByIDAndUserID(ctx context.Context, id, userID int) (int64, error) {
+	var deleted int64
+
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		var (
+			pollID int64
+			owner  sql.NullInt64
+		)
+
+		err := tx.QueryRowContext(ctx, "SELECT id, user_id FROM polls WHERE id = $1 FOR UPDATE", id).Scan(&pollID, &owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			deleted = 0
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !owner.Valid || owner.Int64 != int64(userID) {
+			return ErrNotPollOwner
+		}
+
+		// the buckets of the votes are recounted by the next RefreshSentiment
+		if _, err := tx.ExecContext(
+			ctx,
+			`
+			WITH deleted AS (
+				DELETE FROM votes WHERE poll_id = $1 RETURNING created_at
+			)
+			INSERT INTO ticker_sentiment_retracted (ticker, bucket)
+			SELECT DISTINCT p.ticker, date_trunc('hour', d.created_at) FROM deleted d JOIN polls p ON p.id = $1
+			WHERE d.created_at IS NOT NULL
+			ON CONFLICT DO NOTHING
+			`,
+			pollID,
+		); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM polls WHERE id = $1", pollID)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = result.RowsAffected()
+		return err
+	})
+
+	return deleted, err
 }
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rawnly/votestreet/internal/config"
+)
+
+// connectTestDatabase connects to the database of VOTESTREET_TEST_DATABASE_URL and migrates it,
+// the test is skipped when the variable is not set
+func connectTestDatabase(t *testing.T) context.Context {
+	t.Helper()
+
+	dsn := os.Getenv("VOTESTREET_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("VOTESTREET_TEST_DATABASE_URL is not set")
+	}
+
+	cfg := config.Default().Database
+	cfg.DSN = dsn
+
+	if err := Connect(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx
+}
+
+// uniqueName suffixes the name so reruns against the same database don't collide
+func uniqueName(name string) string {
+	return name + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+func TestUpsertUserSharedEmail(t *testing.T) {
+	ctx := connectTestDatabase(t)
+
+	email := uniqueName("alice") + "@example.com"
+
+	google, err := UpsertUser(ctx, User{OAuthID: uniqueName("google"), Email: email, FirstName: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	github, err := UpsertUser(ctx, User{OAuthID: uniqueName("github|alice"), Email: email, FirstName: "Alice"})
+	if err != nil {
+		t.Fatalf("second provider with the same email: %v", err)
+	}
+
+	if github.ID == google.ID {
+		t.Errorf("both providers share user %d", google.ID)
+	}
+
+	again, err := UpsertUser(ctx, User{OAuthID: google.OAuthID, Email: email, FirstName: "Alicia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.ID != google.ID || again.FirstName != "Alicia" {
+		t.Errorf("user = %+v, want %d with the refreshed profile", again, google.ID)
+	}
+}
+
+func TestPersonalAccessTokenExpiryOffset(t *testing.T) {
+	ctx := connectTestDatabase(t)
+
+	user, err := UpsertUser(ctx, User{OAuthID: uniqueName("test|token"), Email: "token@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).In(time.FixedZone("UTC-8", -8*3600)).Truncate(time.Microsecond)
+	hash := uniqueName("hash")
+
+	if _, err := InsertPersonalAccessToken(ctx, PersonalAccessToken{UserID: user.ID, Name: "ci", ExpiresAt: &expiresAt}, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := GetPersonalAccessTokenByHash(ctx, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.ExpiresAt == nil || !stored.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expires_at = %v, want %v", stored.ExpiresAt, expiresAt)
+	}
+}
+
+func TestDeletePollRetractsSentiment(t *testing.T) {
+	ctx := connectTestDatabase(t)
+
+	symbol := "Z" + strings.ToUpper(strconv.FormatInt(time.Now().UnixNano()%1e12, 36))
+	if _, err := UpsertTickers(ctx, []Ticker{{Symbol: symbol, Name: "Test", Exchange: "TEST", AssetClass: "equity"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := UpsertUser(ctx, User{OAuthID: uniqueName("test|sentiment"), Email: "sentiment@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pollID, err := InsertPoll(ctx, Poll{
+		Title:   "Will it rise?",
+		UserID:  &user.ID,
+		Ticker:  symbol,
+		Options: []PollOption{{Value: "Yes", Sentiment: 1}, {Value: "No", Sentiment: -1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := InsertVote(ctx, Vote{PollID: pollID, UserID: "voter", Value: "Yes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bullish := func() int {
+		t.Helper()
+
+		if _, err := RefreshSentiment(ctx, false); err != nil {
+			t.Fatal(err)
+		}
+
+		sentiment, err := GetTickerSentiment(ctx, symbol)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sentiment.Windows[0].Bullish
+	}
+
+	if got := bullish(); got != 1 {
+		t.Fatalf("bullish = %d before the deletion, want 1", got)
+	}
+
+	if _, err := DeletePollByIDAndUserID(ctx, int(pollID), user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bullish(); got != 0 {
+		t.Errorf("bullish = %d after the deletion, want 0", got)
+	}
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Resolution is the rule a poll is resolved with,
+// the price at closes_at is compared against the target, see resolution.Met
+type Resolution struct {
+	Operator string  `json:"operator"`
+	Target   float64 `json:"target"`
+}
+
+// Outcome is whether the resolution rule of a poll was met, and who called it
+type Outcome struct {
+	// Unresolvable is set when no closing price was recorded in time,
+	// the poll has no winners
+	Unresolvable bool `json:"unresolvable,omitempty"`
+
+	Met      bool      `json:"met"`
+	Price    float64   `json:"price"`
+	PricedAt time.Time `json:"priced_at"`
+	// Sentiment is the direction proven right, 1 bullish, -1 bearish and 0 neutral
+	Sentiment      int      `json:"sentiment"`
+	WinningOptions []string `json:"winning_options"`
+	// CrowdCorrect tells whether the most voted option was a winning one,
+	// nil without a single most voted option or when unresolvable
+	CrowdCorrect *bool     `json:"crowd_correct"`
+	ResolvedAt   time.Time `json:"resolved_at"`
+}
+
+// GetPollsToResolve returns the published polls with a rule closed for at least the delay
+// and not resolved yet, oldest first
+func GetPollsToResolve(ctx context.Context, delay time.Duration) ([]int64, error) {
+	rows, err := database.QueryContext(
+		ctx,
+		`
+		SELECT id FROM polls
+		WHERE resolution_operator IS NOT NULL
+			AND NOT draft
+			AND resolved_at IS NULL
+			AND closes_at <= now() - $1 * interval '1 second'
+		ORDER BY closes_at
+		`,
+		delay.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ResolvePoll records the outcome of a poll unless it was already resolved,
+// returns the number of resolved polls
+func ResolvePoll(ctx context.Context, id int64, outcome Outcome) (int64, error) {
+	payload, err := json.Marshal(outcome)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := database.ExecContext(
+		ctx,
+		"UPDATE polls SET resolved_at = now(), outcome = $2 WHERE id = $1 AND resolved_at IS NULL",
+		id,
+		payload,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
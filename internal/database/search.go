@@ -0,0 +1,53 @@
+package database
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rawnly/votestreet/pkg/ticker"
+)
+
+// SearchResult is a poll matching a search,
+// Snippet is HTML escaped and wraps the matched terms in <mark> tags
+type SearchResult struct {
+	Poll
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// SearchTerms splits a query into the words matched by prefix,
+// punctuation is dropped so the query can't inject tsquery operators
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchSymbols are the words of a query matched exactly against tickers
+func SearchSymbols(query string) []string {
+	symbols := strings.Fields(query)
+	for i := range symbols {
+		symbols[i] = ticker.Normalize(symbols[i])
+	}
+
+	return symbols
+}
+
+// prefixQuery builds a tsquery matching every term as a prefix
+func prefixQuery(terms []string) string {
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// extraScanner scans the poll columns followed by extra columns
+type extraScanner struct {
+	scanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"Apple", []string{"apple"}},
+		{"  apple   earnings ", []string{"apple", "earnings"}},
+		{"Q3 2030", []string{"q3", "2030"}},
+		{"brk.b", []string{"brk", "b"}},
+		{"apple & !tesla | (nvda:*)", []string{"apple", "tesla", "nvda"}},
+		{"l'oréal", []string{"l", "oréal"}},
+		{"", nil},
+		{"&|!:*()", nil},
+	}
+
+	for _, tt := range tests {
+		if got := SearchTerms(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("SearchTerms(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		terms []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"apple"}, "apple:*"},
+		{[]string{"apple", "q3"}, "apple:* & q3:*"},
+		{SearchTerms("apple & !tesla"), "apple:* & tesla:*"},
+	}
+
+	for _, tt := range tests {
+		if got := prefixQuery(slices.Clone(tt.terms)); got != tt.want {
+			t.Errorf("prefixQuery(%q) = %q, want %q", tt.terms, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// sentimentLockID is the advisory lock held while refreshing,
+// instances skip the refresh while another one holds it
+const sentimentLockID = 7_331_000_002
+
+const (
+	// SentimentRetention is the history kept, the longest window plus the partial hour
+	SentimentRetention = 30*24*time.Hour + time.Hour
+	// sentimentOverlap re-reads votes committed after a refresh with an earlier created_at
+	sentimentOverlap = 5 * time.Minute
+)
+
+// SentimentWindow is a rolling window of the index, in hourly buckets
+type SentimentWindow struct {
+	Name  string
+	Hours int
+}
+
+var SentimentWindows = []SentimentWindow{
+	{Name: "24h", Hours: 24},
+	{Name: "7d", Hours: 7 * 24},
+	{Name: "30d", Hours: 30 * 24},
+}
+
+// WindowSentiment counts the votes of a window
+type WindowSentiment struct {
+	Window  string `json:"window"`
+	Bullish int    `json:"bullish"`
+	Bearish int    `json:"bearish"`
+	Neutral int    `json:"neutral"`
+	// Index is (bullish - bearish) / (bullish + bearish), nil without directional votes
+	Index *float64 `json:"index"`
+}
+
+// ComputeIndex sets the index, rounded to four decimals
+func (w *WindowSentiment) ComputeIndex() {
+	directional := w.Bullish + w.Bearish
+	if directional == 0 {
+		w.Index = nil
+		return
+	}
+
+	index := math.Round(float64(w.Bullish-w.Bearish)/float64(directional)*10_000) / 10_000
+	w.Index = &index
+}
+
+// TickerSentiment is the crowd's stance on a symbol across its polls
+type TickerSentiment struct {
+	Symbol      string            `json:"symbol"`
+	Windows     []WindowSentiment `json:"windows"`
+	RefreshedAt *time.Time        `json:"refreshed_at"`
+}
+
+// sentimentTouchedSQL selects the buckets with votes cast or changed since $1
+// and the buckets that lost a vote, newer than the retention horizon $2.
+// The retracted buckets are consumed by the statement.
+const sentimentTouchedSQL = `
+	retracted AS (
+		DELETE FROM ticker_sentiment_retracted RETURNING ticker, bucket
+	),
+	touched AS (
+		SELECT p.ticker, date_trunc('hour', v.created_at) AS bucket
+		FROM votes v
+		JOIN polls p ON p.id = v.poll_id
+		WHERE (v.created_at >= $1 OR v.updated_at >= $1) AND v.created_at >= $2
+		UNION
+		SELECT ticker, bucket FROM retracted WHERE bucket >= $2
+	)
+`
+
+// RefreshSentiment recounts the hourly buckets touched since the last refresh
+// by votes cast, changed or deleted, a full refresh rebuilds the whole retention period.
+// Buckets left without votes are deleted, returns how many buckets were recounted
+func RefreshSentiment(ctx context.Context, full bool) (int64, error) {
+	var refreshed int64
+
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		var locked bool
+		if err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", sentimentLockID).Scan(&locked); err != nil || !locked {
+			return err
+		}
+
+		var now, since, horizon time.Time
+		if err := tx.QueryRowContext(
+			ctx,
+			`
+			WITH horizon AS (SELECT date_trunc('hour', localtimestamp - $3 * interval '1 second') AS t)
+			SELECT
+				localtimestamp,
+				greatest((SELECT refreshed_at FROM ticker_sentiment_state WHERE NOT $1) - $2 * interval '1 second', horizon.t),
+				horizon.t
+			FROM horizon
+			`,
+			full,
+			sentimentOverlap.Seconds(),
+			SentimentRetention.Seconds(),
+		).Scan(&now, &since, &horizon); err != nil {
+			return err
+		}
+
+		if full {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM ticker_sentiment"); err != nil {
+				return err
+			}
+		}
+
+		// emptied buckets are counted as zeros, then deleted with the expired ones
+		result, err := tx.ExecContext(
+			ctx,
+			`
+			WITH `+sentimentTouchedSQL+`
+			INSERT INTO ticker_sentiment (ticker, bucket, bullish, bearish, neutral)
+			SELECT
+				t.ticker,
+				t.bucket,
+				count(o.id) FILTER (WHERE o.sentiment > 0),
+				count(o.id) FILTER (WHERE o.sentiment < 0),
+				count(o.id) FILTER (WHERE o.sentiment = 0)
+			FROM touched t
+			LEFT JOIN polls p ON p.ticker = t.ticker
+			LEFT JOIN votes v ON v.poll_id = p.id AND v.created_at >= t.bucket AND v.created_at < t.bucket + interval '1 hour'
+			LEFT JOIN poll_options o ON o.poll_id = v.poll_id AND o.value = v.value
+			GROUP BY 1, 2
+			ON CONFLICT (ticker, bucket) DO UPDATE SET
+				bullish = excluded.bullish,
+				bearish = excluded.bearish,
+				neutral = excluded.neutral
+			`,
+			since,
+			horizon,
+		)
+		if err != nil {
+			return err
+		}
+
+		if refreshed, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(
+			ctx,
+			"DELETE FROM ticker_sentiment WHERE bucket < $1 OR bullish + bearish + neutral = 0",
+			horizon,
+		); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			`
+			INSERT INTO ticker_sentiment_state (refreshed_at) VALUES ($1)
+			ON CONFLICT (id) DO UPDATE SET refreshed_at = excluded.refreshed_at
+			`,
+			now,
+		)
+
+		return err
+	})
+
+	return refreshed, err
+}
+
+// GetTickerSentiment sums the materialized buckets of each window,
+// the current hour counts toward every window
+func GetTickerSentiment(ctx context.Context, symbol string) (TickerSentiment, error) {
+	sentiment := TickerSentiment{
+		Symbol:  symbol,
+		Windows: make([]WindowSentiment, 0, len(SentimentWindows)),
+	}
+
+	names := make([]string, len(SentimentWindows))
+	hours := make([]int64, len(SentimentWindows))
+	for i, window := range SentimentWindows {
+		names[i], hours[i] = window.Name, int64(window.Hours)
+	}
+
+	rows, err := database.QueryContext(
+		ctx,
+		`
+		SELECT w.name, coalesce(sum(s.bullish), 0), coalesce(sum(s.bearish), 0), coalesce(sum(s.neutral), 0)
+		FROM unnest($2::text[], $3::bigint[]) AS w(name, hours)
+		LEFT JOIN ticker_sentiment s
+			ON s.ticker = $1 AND s.bucket >= date_trunc('hour', localtimestamp) - (w.hours - 1) * interval '1 hour'
+		GROUP BY w.name, w.hours
+		ORDER BY w.hours
+		`,
+		symbol,
+		pq.Array(names),
+		pq.Array(hours),
+	)
+	if err != nil {
+		return sentiment, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var window WindowSentiment
+		if err := rows.Scan(&window.Window, &window.Bullish, &window.Bearish, &window.Neutral); err != nil {
+			return sentiment, err
+		}
+
+		window.ComputeIndex()
+		sentiment.Windows = append(sentiment.Windows, window)
+	}
+
+	if err := rows.Err(); err != nil {
+		return sentiment, err
+	}
+
+	var refreshedAt sql.NullTime
+	err = database.QueryRowContext(ctx, "SELECT refreshed_at FROM ticker_sentiment_state").Scan(&refreshedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return sentiment, err
+	}
+
+	if refreshedAt.Valid {
+		sentiment.RefreshedAt = &refreshedAt.Time
+	}
+
+	return sentiment, nil
+}
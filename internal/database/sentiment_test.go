@@ -0,0 +1,42 @@
+package database
+
+import "testing"
+
+func TestWindowSentimentComputeIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  WindowSentiment
+		want    float64
+		defined bool
+	}{
+		{"no votes", WindowSentiment{}, 0, false},
+		{"neutral only", WindowSentiment{Neutral: 5}, 0, false},
+		{"bullish only", WindowSentiment{Bullish: 3}, 1, true},
+		{"bearish only", WindowSentiment{Bearish: 2, Neutral: 4}, -1, true},
+		{"balanced", WindowSentiment{Bullish: 4, Bearish: 4}, 0, true},
+		{"leaning bullish", WindowSentiment{Bullish: 3, Bearish: 1, Neutral: 10}, 0.5, true},
+		{"rounded", WindowSentiment{Bullish: 2, Bearish: 1}, 0.3333, true},
+		{"rounded negative", WindowSentiment{Bullish: 1, Bearish: 2}, -0.3333, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := tt.window
+			window.ComputeIndex()
+
+			switch {
+			case !tt.defined && window.Index != nil:
+				t.Errorf("Index = %v, want nil", *window.Index)
+			case tt.defined && window.Index == nil:
+				t.Errorf("Index = nil, want %v", tt.want)
+			case tt.defined && *window.Index != tt.want:
+				t.Errorf("Index = %v, want %v", *window.Index, tt.want)
+			}
+		})
+	}
+
+	window := WindowSentiment{Neutral: 1, Index: new(float64)}
+	if window.ComputeIndex(); window.Index != nil {
+		t.Error("ComputeIndex kept a stale index")
+	}
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// PollStore persists polls and their options
+type PollStore interface {
+	InsertPoll(ctx context.Context, payload Poll) (int64, error)
+	GetPollByID(ctx context.Context, id int64) (Poll, error)
+	ListPolls(ctx context.Context, filter PollFilter) (PollPage, error)
+	SearchPolls(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	UpdatePollSchedule(ctx context.Context, id, userID int, update ScheduleUpdate) (int64, error)
+	DeletePollByIDAndUserID(ctx context.Context, id, userID int) (int64, error)
+	FinalizeClosedPolls(ctx context.Context) (int, error)
+	GetPollsToResolve(ctx context.Context, delay time.Duration) ([]int64, error)
+	ResolvePoll(ctx context.Context, id int64, outcome Outcome) (int64, error)
+}
+
+// VoteStore persists votes and aggregates the results
+type VoteStore interface {
+	InsertVote(ctx context.Context, payload Vote) (int64, error)
+	DeleteVote(ctx context.Context, pollID int64, userID string) error
+	GetPollResults(ctx context.Context, pollID int64) (*PollResults, error)
+	OnVoteCommitted(hook VoteHook)
+}
+
+// UserStore persists users and their personal access tokens
+type UserStore interface {
+	GetUserByOAuthID(ctx context.Context, oauthID string) (*User, error)
+	UpsertUser(ctx context.Context, payload User) (*User, error)
+
+	InsertPersonalAccessToken(ctx context.Context, payload PersonalAccessToken, tokenHash string) (*PersonalAccessToken, error)
+	GetPersonalAccessTokensByUserID(ctx context.Context, userID int) ([]PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+	TouchPersonalAccessToken(ctx context.Context, id int) error
+	DeletePersonalAccessTokenByIDAndUserID(ctx context.Context, id, userID int) (int64, error)
+}
+
+// TickerStore persists the ticker registry
+type TickerStore interface {
+	GetTicker(ctx context.Context, symbol string) (Ticker, error)
+	SearchTickers(ctx context.Context, prefix string, limit int) ([]Ticker, error)
+	UpsertTickers(ctx context.Context, tickers []Ticker) (int, error)
+}
+
+// SentimentStore aggregates votes into per-ticker sentiment
+type SentimentStore interface {
+	GetTickerSentiment(ctx context.Context, symbol string) (TickerSentiment, error)
+	RefreshSentiment(ctx context.Context, full bool) (int64, error)
+}
+
+var (
+	_ PollStore      = Postgres{}
+	_ VoteStore      = Postgres{}
+	_ UserStore      = Postgres{}
+	_ TickerStore    = Postgres{}
+	_ SentimentStore = Postgres{}
+)
+
+// Postgres implements the stores on the connected database,
+// errors are translated into domain errors
+type Postgres struct{}
+
+func (Postgres) InsertPoll(ctx context.Context, payload Poll) (int64, error) {
+	return translate(InsertPoll(ctx, payload))
+}
+
+func (Postgres) GetPollByID(ctx context.Context, id int64) (Poll, error) {
+	return translate(GetPollByID(ctx, id))
+}
+
+func (Postgres) ListPolls(ctx context.Context, filter PollFilter) (PollPage, error) {
+	return translate(ListPolls(ctx, filter))
+}
+
+func (Postgres) SearchPolls(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	return translate(SearchPolls(ctx, query, limit))
+}
+
+func (Postgres) UpdatePollSchedule(ctx context.Context, id, userID int, update ScheduleUpdate) (int64, error) {
+	return translate(UpdatePollSchedule(ctx, id, userID, update))
+}
+
+func (Postgres) DeletePollByIDAndUserID(ctx context.Context, id, userID int) (int64, error) {
+	return translate(DeletePollByIDAndUserID(ctx, id, userID))
+}
+
+func (Postgres) FinalizeClosedPolls(ctx context.Context) (int, error) {
+	return translate(FinalizeClosedPolls(ctx))
+}
+
+func (Postgres) GetPollsToResolve(ctx context.Context, delay time.Duration) ([]int64, error) {
+	return translate(GetPollsToResolve(ctx, delay))
+}
+
+func (Postgres) ResolvePoll(ctx context.Context, id int64, outcome Outcome) (int64, error) {
+	return translate(ResolvePoll(ctx, id, outcome))
+}
+
+func (Postgres) InsertVote(ctx context.Context, payload Vote) (int64, error) {
+	return translate(InsertVote(ctx, payload))
+}
+
+func (Postgres) DeleteVote(ctx context.Context, pollID int64, userID string) error {
+	return Translate(DeleteVote(ctx, pollID, userID))
+}
+
+func (Postgres) GetPollResults(ctx context.Context, pollID int64) (*PollResults, error) {
+	return translate(GetPollResults(ctx, pollID))
+}
+
+func (Postgres) OnVoteCommitted(hook VoteHook) {
+	OnVoteCommitted(hook)
+}
+
+func (Postgres) GetUserByOAuthID(ctx context.Context, oauthID string) (*User, error) {
+	return translate(GetUserByOAuthID(ctx, oauthID))
+}
+
+func (Postgres) UpsertUser(ctx context.Context, payload User) (*User, error) {
+	return translate(UpsertUser(ctx, payload))
+}
+
+func (Postgres) InsertPersonalAccessToken(ctx context.Context, payload PersonalAccessToken, tokenHash string) (*PersonalAccessToken, error) {
+	return translate(InsertPersonalAccessToken(ctx, payload, tokenHash))
+}
+
+func (Postgres) GetPersonalAccessTokensByUserID(ctx context.Context, userID int) ([]PersonalAccessToken, error) {
+	return translate(GetPersonalAccessTokensByUserID(ctx, userID))
+}
+
+func (Postgres) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	return translate(GetPersonalAccessTokenByHash(ctx, tokenHash))
+}
+
+func (Postgres) TouchPersonalAccessToken(ctx context.Context, id int) error {
+	return Translate(TouchPersonalAccessToken(ctx, id))
+}
+
+func (Postgres) DeletePersonalAccessTokenByIDAndUserID(ctx context.Context, id, userID int) (int64, error) {
+	return translate(DeletePersonalAccessTokenByIDAndUserID(ctx, id, userID))
+}
+
+func (Postgres) GetTicker(ctx context.Context, symbol string) (Ticker, error) {
+	return translate(GetTicker(ctx, symbol))
+}
+
+func (Postgres) SearchTickers(ctx context.Context, prefix string, limit int) ([]Ticker, error) {
+	return translate(SearchTickers(ctx, prefix, limit))
+}
+
+func (Postgres) UpsertTickers(ctx context.Context, tickers []Ticker) (int, error) {
+	return translate(UpsertTickers(ctx, tickers))
+}
+
+func (Postgres) GetTickerSentiment(ctx context.Context, symbol string) (TickerSentiment, error) {
+	return translate(GetTickerSentiment(ctx, symbol))
+}
+
+func (Postgres) RefreshSentiment(ctx context.Context, full bool) (int64, error) {
+	return translate(RefreshSentiment(ctx, full))
+}
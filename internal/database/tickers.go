@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/rawnly/votestreet/pkg/ticker"
+)
+
+// Asset classes of the registry
+const (
+	AssetClassEquity = "equity"
+	AssetClassETF    = "etf"
+	AssetClassIndex  = "index"
+	AssetClassCrypto = "crypto"
+)
+
+var assetClasses = []string{AssetClassEquity, AssetClassETF, AssetClassIndex, AssetClassCrypto}
+
+//go:embed seed/tickers.csv
+var seedTickers string
+
+// tickersHeader is the header expected by ParseTickersCSV
+var tickersHeader = []string{"symbol", "name", "exchange", "asset_class"}
+
+type Ticker struct {
+	Symbol     string `json:"symbol"`
+	Name       string `json:"name"`
+	Exchange   string `json:"exchange"`
+	AssetClass string `json:"asset_class"`
+}
+
+// ParseTickersCSV reads a symbol,name,exchange,asset_class file with a header row,
+// symbols are normalized
+func ParseTickersCSV(r io.Reader) ([]Ticker, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(tickersHeader)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	for i, column := range tickersHeader {
+		if strings.ToLower(strings.TrimSpace(header[i])) != column {
+			return nil, fmt.Errorf("header must be %s", strings.Join(tickersHeader, ","))
+		}
+	}
+
+	var (
+		tickers []Ticker
+		seen    = make(map[string]bool)
+	)
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return tickers, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		t := Ticker{
+			Symbol:     ticker.Normalize(record[0]),
+			Name:       strings.TrimSpace(record[1]),
+			Exchange:   strings.TrimSpace(record[2]),
+			AssetClass: strings.ToLower(strings.TrimSpace(record[3])),
+		}
+
+		switch {
+		case !ticker.Valid(t.Symbol):
+			return nil, fmt.Errorf("line %d: invalid symbol %q", line, record[0])
+		case seen[t.Symbol]:
+			return nil, fmt.Errorf("line %d: duplicate symbol %s", line, t.Symbol)
+		case t.Name == "" || t.Exchange == "":
+			return nil, fmt.Errorf("line %d: name and exchange are required", line)
+		case !slices.Contains(assetClasses, t.AssetClass):
+			return nil, fmt.Errorf("line %d: asset class must be one of %s", line, strings.Join(assetClasses, ", "))
+		}
+
+		seen[t.Symbol] = true
+		tickers = append(tickers, t)
+	}
+}
+
+// UpsertTickers inserts the tickers or refreshes the existing ones atomically,
+// returns how many were written
+func UpsertTickers(ctx context.Context, tickers []Ticker) (int, error) {
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(
+			ctx,
+			`
+			INSERT INTO tickers (symbol, name, exchange, asset_class)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (symbol) DO UPDATE SET
+				name = excluded.name,
+				exchange = excluded.exchange,
+				asset_class = excluded.asset_class,
+				updated_at = now()
+			`,
+		)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, ticker := range tickers {
+			if _, err := stmt.ExecContext(ctx, ticker.Symbol, ticker.Name, ticker.Exchange, ticker.AssetClass); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(tickers), nil
+}
+
+// SeedTickers imports the bundled registry into an empty tickers table,
+// returns how many were imported
+func SeedTickers(ctx context.Context) (int, error) {
+	var exists bool
+	if err := database.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM tickers)").Scan(&exists); err != nil || exists {
+		return 0, err
+	}
+
+	tickers, err := BundledTickers()
+	if err != nil {
+		return 0, err
+	}
+
+	return UpsertTickers(ctx, tickers)
+}
+
+// BundledTickers parses the registry shipped with the binary
+func BundledTickers() ([]Ticker, error) {
+	return ParseTickersCSV(strings.NewReader(seedTickers))
+}
+
+func GetTicker(ctx context.Context, symbol string) (Ticker, error) {
+	var ticker Ticker
+	err := database.QueryRowContext(
+		ctx,
+		"SELECT symbol, name, exchange, asset_class FROM tickers WHERE symbol = $1",
+		symbol,
+	).Scan(&ticker.Symbol, &ticker.Name, &ticker.Exchange, &ticker.AssetClass)
+
+	return ticker, err
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// SearchTickers autocompletes a prefix of a symbol or a company name,
+// exact symbols first, then symbol prefixes, then names
+func SearchTickers(ctx context.Context, prefix string, limit int) ([]Ticker, error) {
+	rows, err := database.QueryContext(
+		ctx,
+		`
+		SELECT symbol, name, exchange, asset_class FROM tickers
+		WHERE symbol LIKE $1 || '%' OR lower(name) LIKE $2 || '%'
+		ORDER BY symbol = $3 DESC, symbol LIKE $1 || '%' DESC, symbol
+		LIMIT $4
+		`,
+		likeEscaper.Replace(ticker.Normalize(prefix)),
+		likeEscaper.Replace(strings.ToLower(prefix)),
+		ticker.Normalize(prefix),
+		max(limit, 1),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickers := []Ticker{}
+	for rows.Next() {
+		var ticker Ticker
+		if err := rows.Scan(&ticker.Symbol, &ticker.Name, &ticker.Exchange, &ticker.AssetClass); err != nil {
+			return nil, err
+		}
+		tickers = append(tickers, ticker)
+	}
+
+	return tickers, rows.Err()
+}
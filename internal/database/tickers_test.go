@@ -0,0 +1,71 @@
+package database
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseTickersCSV(t *testing.T) {
+	const header = "symbol,name,exchange,asset_class\n"
+
+	tests := []struct {
+		name  string
+		input string
+		want  []Ticker
+		err   string
+	}{
+		{
+			name:  "normalizes rows",
+			input: header + "aapl, Apple Inc. ,NASDAQ,Equity\nBRK-B,Berkshire Hathaway,NYSE,equity\n",
+			want: []Ticker{
+				{Symbol: "AAPL", Name: "Apple Inc.", Exchange: "NASDAQ", AssetClass: AssetClassEquity},
+				{Symbol: "BRK.B", Name: "Berkshire Hathaway", Exchange: "NYSE", AssetClass: AssetClassEquity},
+			},
+		},
+		{name: "header only", input: header},
+		{name: "case insensitive header", input: "Symbol, Name, Exchange, Asset_Class\nSPY,SPDR S&P 500,NYSE Arca,etf\n", want: []Ticker{
+			{Symbol: "SPY", Name: "SPDR S&P 500", Exchange: "NYSE Arca", AssetClass: AssetClassETF},
+		}},
+		{name: "empty", input: "", err: "read header"},
+		{name: "wrong header", input: "ticker,name,exchange,asset_class\n", err: "header must be"},
+		{name: "missing column", input: header + "AAPL,Apple Inc.,NASDAQ\n", err: "wrong number of fields"},
+		{name: "invalid symbol", input: header + "A_PL,Apple Inc.,NASDAQ,equity\n", err: `line 2: invalid symbol "A_PL"`},
+		{name: "duplicate symbol", input: header + "BRK.B,Berkshire,NYSE,equity\nbrk/b,Berkshire,NYSE,equity\n", err: "line 3: duplicate symbol BRK.B"},
+		{name: "missing name", input: header + "AAPL, ,NASDAQ,equity\n", err: "line 2: name and exchange are required"},
+		{name: "unknown asset class", input: header + "AAPL,Apple Inc.,NASDAQ,bond\n", err: "line 2: asset class must be one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tickers, err := ParseTickersCSV(strings.NewReader(tt.input))
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParseTickersCSV() error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(tickers, tt.want) {
+				t.Errorf("ParseTickersCSV() = %+v, want %+v", tickers, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTickersCSVSeed(t *testing.T) {
+	tickers, err := ParseTickersCSV(strings.NewReader(seedTickers))
+	if err != nil {
+		t.Fatalf("the bundled tickers are invalid: %v", err)
+	}
+
+	if len(tickers) == 0 {
+		t.Error("the bundled tickers are empty")
+	}
+}
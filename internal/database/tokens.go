@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// OAuthID is the OAuth ID of the owner
+	OAuthID string `json:"-"`
+}
+
+// InsertPersonalAccessToken stores a token by its hash, the plain token is never persisted
+func InsertPersonalAccessToken(ctx context.Context, payload PersonalAccessToken, tokenHash string) (*PersonalAccessToken, error) {
+	row := database.QueryRowContext(
+		ctx,
+		`
+		INSERT INTO personal_access_tokens
+		(user_id, name, token_hash, scopes, expires_at)
+		VALUES
+		($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+		`,
+		payload.UserID,
+		payload.Name,
+		tokenHash,
+		pq.Array(payload.Scopes),
+		payload.ExpiresAt,
+	)
+
+	if err := row.Scan(&payload.ID, &payload.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return &payload, nil
+}
+
+func GetPersonalAccessTokensByUserID(ctx context.Context, userID int) ([]PersonalAccessToken, error) {
+	rows, err := database.QueryContext(
+		ctx,
+		`
+		SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		var token PersonalAccessToken
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Name, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// GetPersonalAccessTokenByHash gets a token and the OAuth ID of its owner
+func GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	row := database.QueryRowContext(
+		ctx,
+		`
+		SELECT t.id, t.user_id, t.name, t.scopes, t.expires_at, t.last_used_at, t.created_at, u.oauth_id
+		FROM personal_access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+		`,
+		tokenHash,
+	)
+
+	var token PersonalAccessToken
+	if err := row.Scan(&token.ID, &token.UserID, &token.Name, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt, &token.OAuthID); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func TouchPersonalAccessToken(ctx context.Context, id int) error {
+	_, err := database.ExecContext(ctx, "UPDATE personal_access_tokens SET last_used_at = now() WHERE id = $1", id)
+	return err
+}
+
+func DeletePersonalAccessTokenByIDAndUserID(ctx context.Context, id, userID int) (int64, error) {
+	result, err := database.ExecContext(ctx, "DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
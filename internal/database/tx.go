@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxTxAttempts = 3
+	txRetryDelay  = 20 * time.Millisecond
+)
+
+// WithTx runs fn in a transaction, committing when it returns nil
+// and rolling back otherwise. Transactions aborted by serialization
+// failures or deadlocks are retried, fn must be safe to run again.
+//
+// Example:
+//
+//	err := WithTx(ctx, func(tx *sql.Tx) error {
+//		_, err := tx.ExecContext(ctx, "UPDATE polls SET votes_count = votes_count + 1 WHERE id = $1", id)
+//		return err
+//	})
+func WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if database == nil {
+		return ErrDatabaseNotConnected
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, fn)
+		if err == nil || attempt >= maxTxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Msg("Retrying transaction")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(txRetryDelay * time.Duration(attempt)):
+		}
+	}
+}
+
+func runTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Error().Err(rollbackErr).Msg("Failed to rollback transaction")
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isRetryable reports whether postgres aborted the transaction
+// because of a serialization failure or a deadlock
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
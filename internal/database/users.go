@@ -2,6 +2,8 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 
 	"github.com/rs/zerolog/log"
 )
@@ -14,31 +16,9 @@ type User struct {
 	LastName  string `json:"last_name"`
 }
 
-func createUsersTable() error {
-	return execute(`
-create table if not exists public.users
-(
-    id         serial
-        constraint users_pk_2
-            primary key,
-    oauth_id   text not null
-        constraint users_pk
-            unique,
-    email      text not null
-        constraint users_pk_3
-            unique,
-    first_name text not null,
-    last_name  text not null
-);
-
-create index if not exists users_oauth_id_index
-	on public.users (oauth_id);
-		`)
-}
-
 // GetUserByOAuthID gets a user by their OAuth ID
 func GetUserByOAuthID(ctx context.Context, oauthID string) (*User, error) {
-	result := database.QueryRowContext(ctx, "SELECT * FROM users WHERE oauth_id = $1", oauthID)
+	result := database.QueryRowContext(ctx, "SELECT id, oauth_id, email, first_name, last_name FROM users WHERE oauth_id = $1", oauthID)
 	if result.Err() != nil {
 		log.Error().Str("oauth_id", oauthID).Err(result.Err()).Msg("Failed to get user")
 		return nil, result.Err()
@@ -61,7 +41,7 @@ func CreateUser(ctx context.Context, user *User) error {
 // InsertIfNotExists inserts a user if it does not exist
 func InsertIfNotExists(ctx context.Context, payload User) error {
 	user, err := GetUserByOAuthID(ctx, payload.OAuthID)
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
 
@@ -71,3 +51,35 @@ func InsertIfNotExists(ctx context.Context, payload User) error {
 
 	return CreateUser(ctx, &payload)
 }
+
+// UpsertUser inserts a user or refreshes its profile fields
+// if a user with the same OAuth ID already exists.
+// Emails are not unique, each provider signed in with gets its own user
+func UpsertUser(ctx context.Context, payload User) (*User, error) {
+	row := database.QueryRowContext(
+		ctx,
+		`
+		INSERT INTO users
+		(oauth_id, email, first_name, last_name)
+		VALUES
+		($1, $2, $3, $4)
+		ON CONFLICT (oauth_id) DO UPDATE SET
+			email = excluded.email,
+			first_name = excluded.first_name,
+			last_name = excluded.last_name
+		RETURNING id, oauth_id, email, first_name, last_name
+		`,
+		payload.OAuthID,
+		payload.Email,
+		payload.FirstName,
+		payload.LastName,
+	)
+
+	var user User
+	if err := row.Scan(&user.ID, &user.OAuthID, &user.Email, &user.FirstName, &user.LastName); err != nil {
+		log.Error().Str("oauth_id", payload.OAuthID).Err(err).Msg("Failed to upsert user")
+		return nil, err
+	}
+
+	return &user, nil
+}
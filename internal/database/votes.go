@@ -2,6 +2,11 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -13,36 +18,129 @@ type Vote struct {
 	Value  string `json:"value"`
 }
 
-func createVotesTable() error {
-	return execute(`
-create table if not exists public.votes
-(
-    id      serial
-        constraint votes_pk
-            primary key,
-    poll_id serial not null
-        constraint votes_polls_id_fk
-            references public.polls,
-    user_id text   not null,
-    value   varchar(1),
-    created_at timestamp default now(),
-    constraint votes_pk_2
-        unique (poll_id, user_id)
-);
-
-alter table public.votes
-		add column if not exists created_at timestamp default now();
-`)
+var ErrVoteLocked = &Error{Kind: ErrConflict, Message: "votes on this poll cannot be changed once cast"}
+
+// OptionResult is the tally of a single option
+type OptionResult struct {
+	Value      string  `json:"value"`
+	Count      int     `json:"count"`
+	Percentage float64 `json:"percentage"`
+}
+
+// PollResults are the aggregated votes of a poll, without voter IDs
+type PollResults struct {
+	PollID     int64          `json:"poll_id"`
+	Total      int            `json:"total"`
+	LastVoteAt *time.Time     `json:"last_vote_at"`
+	Options    []OptionResult `json:"options"`
+}
+
+// VoteHook is called after a vote transaction commits
+type VoteHook func(ctx context.Context, vote Vote)
+
+var (
+	hooksMu   sync.RWMutex
+	voteHooks []VoteHook
+)
+
+// OnVoteCommitted registers a hook called after every committed vote
+func OnVoteCommitted(hook VoteHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	voteHooks = append(voteHooks, hook)
 }
 
-// transactional
+func runVoteHooks(ctx context.Context, vote Vote) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+
+	for _, hook := range voteHooks {
+		hook(ctx, vote)
+	}
+}
+
+// adjustOptionCount moves the tally of an option by delta,
+// fails with ErrInvalidOption when the value is not an option of the poll
+func adjustOptionCount(ctx context.Context, tx *sql.Tx, pollID int64, value string, delta int) error {
+	result, err := tx.ExecContext(
+		ctx,
+		"UPDATE poll_options SET votes_count = votes_count + $3 WHERE poll_id = $1 AND value = $2",
+		pollID,
+		value,
+		delta,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update option votes count")
+		return err
+	}
+
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return ErrInvalidOption
+	}
+
+	return nil
+}
+
+// InsertVote casts a vote, or changes the previous vote
+// of the same user unless the poll locks votes once cast.
+// Returns the ID of the vote.
 func InsertVote(ctx context.Context, payload Vote) (int64, error) {
-	tx, err := database.BeginTx(ctx, nil)
+	var (
+		voteID  int64
+		changed bool
+	)
+
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		changed = false
+
+		locked, err := checkPollOpen(ctx, tx, payload.PollID)
+		if err != nil {
+			return err
+		}
+
+		var previous string
+		err = tx.QueryRowContext(
+			ctx,
+			"SELECT id, value FROM votes WHERE poll_id = $1 AND user_id = $2 FOR UPDATE",
+			payload.PollID,
+			payload.UserID,
+		).Scan(&voteID, &previous)
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			changed = true
+			return insertVote(ctx, tx, payload, &voteID)
+		case err != nil:
+			return err
+		case locked:
+			return ErrVoteLocked
+		case previous == payload.Value:
+			return nil
+		default:
+			changed = true
+			return changeVote(ctx, tx, payload, previous)
+		}
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	result, err := tx.ExecContext(
+	if changed {
+		runVoteHooks(ctx, payload)
+	}
+
+	return voteID, nil
+}
+
+func insertVote(ctx context.Context, tx *sql.Tx, payload Vote, voteID *int64) error {
+	if err := adjustOptionCount(ctx, tx, payload.PollID, payload.Value, 1); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRowContext(
 		ctx,
 		`
 		INSERT INTO votes 
@@ -54,23 +152,96 @@ func InsertVote(ctx context.Context, payload Vote) (int64, error) {
 		payload.PollID,
 		payload.UserID,
 		payload.Value,
-	)
-	if err != nil {
+	).Scan(voteID); err != nil {
 		log.Error().Err(err).Msg("Failed to insert vote")
-		return 0, err
+		return err
 	}
 
 	if _, err := tx.ExecContext(ctx, "UPDATE polls SET votes_count = votes_count + 1 WHERE id = $1", payload.PollID); err != nil {
 		log.Error().Err(err).Msg("Failed to update poll votes count")
-		return 0, err
+		return err
 	}
 
-	if _, err := tx.ExecContext(ctx, "COMMIT"); err != nil {
-		log.Error().Err(err).Msg("Failed to commit transaction")
-		return 0, err
+	return nil
+}
+
+// changeVote moves a vote from the previous option to the new one
+func changeVote(ctx context.Context, tx *sql.Tx, payload Vote, previous string) error {
+	if err := adjustOptionCount(ctx, tx, payload.PollID, payload.Value, 1); err != nil {
+		return err
+	}
+
+	if err := adjustOptionCount(ctx, tx, payload.PollID, previous, -1); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"UPDATE votes SET value = $3, updated_at = now() WHERE poll_id = $1 AND user_id = $2",
+		payload.PollID,
+		payload.UserID,
+		payload.Value,
+	); err != nil {
+		log.Error().Err(err).Msg("Failed to change vote")
+		return err
+	}
+
+	return nil
+}
+
+// DeleteVote retracts the vote of a user,
+// returns sql.ErrNoRows if the user did not vote
+func DeleteVote(ctx context.Context, pollID int64, userID string) error {
+	var value string
+
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		locked, err := checkPollOpen(ctx, tx, pollID)
+		if err != nil {
+			return err
+		}
+
+		if locked {
+			return ErrVoteLocked
+		}
+
+		// the bucket of the vote is recounted by the next RefreshSentiment
+		if err := tx.QueryRowContext(
+			ctx,
+			`
+			WITH deleted AS (
+				DELETE FROM votes WHERE poll_id = $1 AND user_id = $2 RETURNING value, created_at
+			), retracted AS (
+				INSERT INTO ticker_sentiment_retracted (ticker, bucket)
+				SELECT p.ticker, date_trunc('hour', d.created_at) FROM deleted d JOIN polls p ON p.id = $1
+				WHERE d.created_at IS NOT NULL
+				ON CONFLICT DO NOTHING
+			)
+			SELECT value FROM deleted
+			`,
+			pollID,
+			userID,
+		).Scan(&value); err != nil {
+			return err
+		}
+
+		if err := adjustOptionCount(ctx, tx, pollID, value, -1); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE polls SET votes_count = votes_count - 1 WHERE id = $1", pollID); err != nil {
+			log.Error().Err(err).Msg("Failed to update poll votes count")
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return result.RowsAffected()
+	runVoteHooks(ctx, Vote{PollID: pollID, UserID: userID, Value: value})
+
+	return nil
 }
 
 func GetVotesByPoll(ctx context.Context, pollID int) ([]Vote, error) {
@@ -99,3 +270,75 @@ func GetVotesByPoll(ctx context.Context, pollID int) ([]Vote, error) {
 
 	return votes, nil
 }
+
+// GetPollResults counts the votes of each option of a poll
+func GetPollResults(ctx context.Context, pollID int64) (*PollResults, error) {
+	var exists bool
+	if err := database.QueryRowContext(ctx, "SELECT exists(SELECT 1 FROM polls WHERE id = $1)", pollID).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := database.QueryContext(
+		ctx,
+		`
+		SELECT o.value, count(v.id), max(v.created_at)
+		FROM poll_options o
+		LEFT JOIN votes v ON v.poll_id = o.poll_id AND v.value = o.value
+		WHERE o.poll_id = $1
+		GROUP BY o.id, o.value, o.position
+		ORDER BY o.position
+		`,
+		pollID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := &PollResults{
+		PollID:  pollID,
+		Options: []OptionResult{},
+	}
+
+	for rows.Next() {
+		var (
+			option     OptionResult
+			lastVoteAt sql.NullTime
+		)
+
+		if err := rows.Scan(&option.Value, &option.Count, &lastVoteAt); err != nil {
+			return nil, err
+		}
+
+		if lastVoteAt.Valid && (results.LastVoteAt == nil || lastVoteAt.Time.After(*results.LastVoteAt)) {
+			results.LastVoteAt = &lastVoteAt.Time
+		}
+
+		results.Total += option.Count
+		results.Options = append(results.Options, option)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results.ComputePercentages()
+
+	return results, nil
+}
+
+// ComputePercentages sets the share of each option, rounded to two decimals
+func (r *PollResults) ComputePercentages() {
+	if r.Total == 0 {
+		return
+	}
+
+	for i := range r.Options {
+		percentage := float64(r.Options[i].Count) / float64(r.Total) * 100
+		r.Options[i].Percentage = math.Round(percentage*100) / 100
+	}
+}
@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Every runs the job at each interval until the context is cancelled,
+// a failed run is logged and retried at the next tick
+func Every(ctx context.Context, name string, interval time.Duration, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Str("job", name).Msg("Job failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Group tracks background workers so they can be flushed on shutdown
+type Group struct {
+	wg sync.WaitGroup
+}
+
+// Go runs fn in a tracked goroutine
+func (g *Group) Go(fn func()) {
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until every worker returned or the context is done
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,164 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rawnly/votestreet/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMaxSubscribersPerPoll caps the streams open on a single poll per instance
+	DefaultMaxSubscribersPerPoll = 500
+
+	channelPattern   = "polls:*:results"
+	resubscribeDelay = 5 * time.Second
+)
+
+var (
+	ErrTooManySubscribers = errors.New("too many subscribers for this poll")
+	ErrHubClosed          = errors.New("hub is closed")
+)
+
+func channel(pollID int64) string {
+	return fmt.Sprintf("polls:%d:results", pollID)
+}
+
+// Subscriber receives the latest payloads of a poll,
+// slow readers only get the most recent one.
+// C is closed when the hub stops.
+type Subscriber struct {
+	pollID int64
+	C      chan []byte
+}
+
+// Hub fans out poll updates published on redis to the local subscribers
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[*Subscriber]struct{}
+	maxPerPoll  int
+	closed      bool
+}
+
+func NewHub(maxPerPoll int) *Hub {
+	return &Hub{
+		subscribers: make(map[int64]map[*Subscriber]struct{}),
+		maxPerPoll:  maxPerPoll,
+	}
+}
+
+func (h *Hub) Subscribe(pollID int64) (*Subscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	subscribers, ok := h.subscribers[pollID]
+	if !ok {
+		subscribers = make(map[*Subscriber]struct{})
+		h.subscribers[pollID] = subscribers
+	}
+
+	if len(subscribers) >= h.maxPerPoll {
+		return nil, ErrTooManySubscribers
+	}
+
+	subscriber := &Subscriber{
+		pollID: pollID,
+		C:      make(chan []byte, 1),
+	}
+	subscribers[subscriber] = struct{}{}
+
+	return subscriber, nil
+}
+
+func (h *Hub) Unsubscribe(subscriber *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscribers := h.subscribers[subscriber.pollID]
+	delete(subscribers, subscriber)
+
+	if len(subscribers) == 0 {
+		delete(h.subscribers, subscriber.pollID)
+	}
+}
+
+// Publish sends the payload to the subscribers of every instance
+func (h *Hub) Publish(ctx context.Context, pollID int64, payload []byte) error {
+	return storage.Publish(ctx, channel(pollID), payload)
+}
+
+// Run relays the published payloads to the local subscribers
+// until the context is cancelled, resubscribing when redis is unavailable.
+// Every subscriber is closed once it returns.
+func (h *Hub) Run(ctx context.Context) {
+	defer h.close()
+
+	for {
+		err := h.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Error().Err(err).Msg("Poll updates subscription lost")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// close ends every stream and rejects new subscribers
+func (h *Hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for pollID, subscribers := range h.subscribers {
+		for subscriber := range subscribers {
+			close(subscriber.C)
+		}
+
+		delete(h.subscribers, pollID)
+	}
+}
+
+func (h *Hub) subscribe(ctx context.Context) error {
+	return storage.Subscribe(ctx, channelPattern, func(channel string, payload []byte) {
+		var pollID int64
+		if _, err := fmt.Sscanf(channel, "polls:%d:results", &pollID); err != nil {
+			log.Error().Err(err).Str("channel", channel).Msg("Invalid poll channel")
+			return
+		}
+
+		h.broadcast(pollID, payload)
+	})
+}
+
+func (h *Hub) broadcast(pollID int64, payload []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for subscriber := range h.subscribers[pollID] {
+		select {
+		case subscriber.C <- payload:
+		default:
+			// drop the stale payload, the new one supersedes it
+			select {
+			case <-subscriber.C:
+			default:
+			}
+
+			subscriber.C <- payload
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package market
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rawnly/votestreet/pkg/ticker"
+)
+
+var _ PriceSource = (*CSVSource)(nil)
+
+// csvHeader is the header expected by ParsePricesCSV
+var csvHeader = []string{"symbol", "time", "price"}
+
+// CSVSource serves the prices of a local CSV file, reloaded when the file changes
+type CSVSource struct {
+	path   string
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	modTime time.Time
+	prices  map[string][]Price
+}
+
+// NewCSVSource loads the file, prices older than maxAge are not returned
+func NewCSVSource(path string, maxAge time.Duration) (*CSVSource, error) {
+	s := &CSVSource{
+		path:   path,
+		maxAge: maxAge,
+	}
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *CSVSource) PriceAt(_ context.Context, symbol string, at time.Time) (Price, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return Price{}, err
+	}
+
+	prices := s.prices[ticker.Normalize(symbol)]
+	i := sort.Search(len(prices), func(i int) bool {
+		return prices[i].At.After(at)
+	})
+
+	if i == 0 || at.Sub(prices[i-1].At) > s.maxAge {
+		return Price{}, ErrNoPrice
+	}
+
+	return prices[i-1], nil
+}
+
+// reload parses the file again if it was modified, the lock must be held
+func (s *CSVSource) reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	if s.prices != nil && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	prices, err := ParsePricesCSV(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	s.prices, s.modTime = prices, info.ModTime()
+
+	return nil
+}
+
+// ParsePricesCSV reads a symbol,time,price file with a header row,
+// times are RFC 3339 or dates, returns the prices of each symbol by time
+func ParsePricesCSV(r io.Reader) (map[string][]Price, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	for i, column := range csvHeader {
+		if strings.ToLower(strings.TrimSpace(header[i])) != column {
+			return nil, fmt.Errorf("header must be %s", strings.Join(csvHeader, ","))
+		}
+	}
+
+	prices := make(map[string][]Price)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		price := Price{Symbol: ticker.Normalize(record[0])}
+
+		if !ticker.Valid(price.Symbol) {
+			return nil, fmt.Errorf("line %d: invalid symbol %q", line, record[0])
+		}
+
+		if price.At, err = parseTime(strings.TrimSpace(record[1])); err != nil {
+			return nil, fmt.Errorf("line %d: invalid time %q", line, record[1])
+		}
+
+		if price.Value, err = strconv.ParseFloat(strings.TrimSpace(record[2]), 64); err != nil || price.Value <= 0 {
+			return nil, fmt.Errorf("line %d: invalid price %q", line, record[2])
+		}
+
+		prices[price.Symbol] = append(prices[price.Symbol], price)
+	}
+
+	for _, series := range prices {
+		sort.SliceStable(series, func(i, j int) bool {
+			return series[i].At.Before(series[j].At)
+		})
+	}
+
+	return prices, nil
+}
+
+// parseTime reads an RFC 3339 timestamp or a date, in UTC
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), err
+}
@@ -0,0 +1,121 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePricesCSV(t *testing.T) {
+	const header = "symbol,time,price\n"
+
+	day := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		input string
+		want  map[string][]Price
+		err   string
+	}{
+		{
+			name:  "sorts each symbol by time",
+			input: header + "aapl,2030-01-02T16:00:00-05:00,187.5\nAAPL,2030-01-02,185\nbrk-b, 2030-01-02 ,410.25\n",
+			want: map[string][]Price{
+				"AAPL": {
+					{Symbol: "AAPL", At: day, Value: 185},
+					{Symbol: "AAPL", At: day.Add(21 * time.Hour), Value: 187.5},
+				},
+				"BRK.B": {{Symbol: "BRK.B", At: day, Value: 410.25}},
+			},
+		},
+		{name: "header only", input: header, want: map[string][]Price{}},
+		{name: "empty", input: "", err: "read header"},
+		{name: "wrong header", input: "ticker,time,price\n", err: "header must be symbol,time,price"},
+		{name: "missing column", input: header + "AAPL,2030-01-02\n", err: "wrong number of fields"},
+		{name: "invalid symbol", input: header + "A_PL,2030-01-02,1\n", err: `line 2: invalid symbol "A_PL"`},
+		{name: "invalid time", input: header + "AAPL,yesterday,1\n", err: `line 2: invalid time "yesterday"`},
+		{name: "invalid price", input: header + "AAPL,2030-01-02,abc\n", err: `line 2: invalid price "abc"`},
+		{name: "zero price", input: header + "AAPL,2030-01-02,0\n", err: `line 2: invalid price "0"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prices, err := ParsePricesCSV(strings.NewReader(tt.input))
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ParsePricesCSV() error = %v, want %q", err, tt.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(prices) != len(tt.want) {
+				t.Fatalf("ParsePricesCSV() = %+v, want %+v", prices, tt.want)
+			}
+
+			for symbol, series := range tt.want {
+				if !slices.EqualFunc(prices[symbol], series, func(a, b Price) bool {
+					return a.Symbol == b.Symbol && a.At.Equal(b.At) && a.Value == b.Value
+				}) {
+					t.Errorf("prices of %s = %+v, want %+v", symbol, prices[symbol], series)
+				}
+			}
+		})
+	}
+}
+
+func TestCSVSourcePriceAt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(path, []byte("symbol,time,price\nAAPL,2030-01-02,185\nAAPL,2030-01-03,187.5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := NewCSVSource(path, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		symbol string
+		at     time.Time
+		want   float64
+	}{
+		{"at a price", "AAPL", day, 185},
+		{"between prices", "aapl", day.Add(12 * time.Hour), 185},
+		{"after the last price", "AAPL", day.Add(72 * time.Hour), 187.5},
+		{"before the first price", "AAPL", day.Add(-time.Hour), 0},
+		{"too old", "AAPL", day.Add(96 * time.Hour), 0},
+		{"unknown symbol", "MSFT", day, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, err := source.PriceAt(context.Background(), tt.symbol, tt.at)
+
+			if tt.want == 0 {
+				if !errors.Is(err, ErrNoPrice) {
+					t.Errorf("PriceAt() = %+v, %v, want ErrNoPrice", price, err)
+				}
+
+				return
+			}
+
+			if err != nil || price.Value != tt.want {
+				t.Errorf("PriceAt() = %+v, %v, want %v", price, err, tt.want)
+			}
+		})
+	}
+}
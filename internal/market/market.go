@@ -0,0 +1,22 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNoPrice = errors.New("no price recorded")
+
+type Price struct {
+	Symbol string    `json:"symbol"`
+	At     time.Time `json:"at"`
+	Value  float64   `json:"value"`
+}
+
+// PriceSource looks up recorded prices of a symbol
+type PriceSource interface {
+	// PriceAt returns the last price recorded at or before the time,
+	// ErrNoPrice when there is none recent enough
+	PriceAt(ctx context.Context, symbol string, at time.Time) (Price, error)
+}
@@ -0,0 +1,110 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/pkg/resolution"
+	"github.com/rs/zerolog/log"
+)
+
+// Resolve evaluates the rule of a closed poll against its closing price,
+// the options meeting the rule win when it is met and the others when it is not
+func Resolve(poll database.Poll, price Price, now time.Time) database.Outcome {
+	outcome := database.Outcome{
+		Met:            resolution.Met(poll.Resolution.Operator, price.Value, poll.Resolution.Target),
+		Price:          price.Value,
+		PricedAt:       price.At,
+		WinningOptions: []string{},
+		ResolvedAt:     now,
+	}
+
+	switch {
+	case price.Value > poll.Resolution.Target:
+		outcome.Sentiment = 1
+	case price.Value < poll.Resolution.Target:
+		outcome.Sentiment = -1
+	}
+
+	var (
+		leader *database.PollOption
+		tied   bool
+	)
+
+	for i, option := range poll.Options {
+		if option.MeetsRule == outcome.Met {
+			outcome.WinningOptions = append(outcome.WinningOptions, option.Value)
+		}
+
+		switch {
+		case option.VotesCount == 0:
+		case leader == nil || option.VotesCount > leader.VotesCount:
+			leader, tied = &poll.Options[i], false
+		case option.VotesCount == leader.VotesCount:
+			tied = true
+		}
+	}
+
+	if leader != nil && !tied {
+		correct := leader.MeetsRule == outcome.Met
+		outcome.CrowdCorrect = &correct
+	}
+
+	return outcome
+}
+
+// Unresolvable is the outcome of a poll without a closing price
+func Unresolvable(now time.Time) database.Outcome {
+	return database.Outcome{
+		Unresolvable:   true,
+		WinningOptions: []string{},
+		ResolvedAt:     now,
+	}
+}
+
+// ResolvePolls resolves the polls closed for at least the delay,
+// polls without a recorded closing price are retried on the next run
+// until they closed timeout ago and are marked unresolvable,
+// returns how many were resolved
+func ResolvePolls(ctx context.Context, polls database.PollStore, source PriceSource, delay, timeout time.Duration) (int, error) {
+	ids, err := polls.GetPollsToResolve(ctx, delay)
+	if err != nil {
+		return 0, err
+	}
+
+	resolved := 0
+	for _, id := range ids {
+		poll, err := polls.GetPollByID(ctx, id)
+		if err != nil {
+			return resolved, err
+		}
+
+		now := time.Now().UTC()
+
+		var outcome database.Outcome
+		price, err := source.PriceAt(ctx, poll.Ticker, *poll.ClosesAt)
+		switch {
+		case err == nil:
+			outcome = Resolve(poll, price, now)
+		case !errors.Is(err, ErrNoPrice):
+			return resolved, err
+		case now.Sub(*poll.ClosesAt) < timeout:
+			log.Debug().Int64("poll_id", id).Str("ticker", poll.Ticker).Msg("No closing price recorded yet")
+			continue
+		default:
+			log.Warn().Int64("poll_id", id).Str("ticker", poll.Ticker).Msg("No closing price recorded, giving up")
+			outcome = Unresolvable(now)
+		}
+
+		n, err := polls.ResolvePoll(ctx, id, outcome)
+		if err != nil {
+			return resolved, err
+		}
+
+		resolved += int(n)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,169 @@
+package market
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/internal/database/memory"
+	"github.com/rawnly/votestreet/pkg/resolution"
+)
+
+func TestResolve(t *testing.T) {
+	now := time.Date(2030, 1, 2, 16, 0, 0, 0, time.UTC)
+	closedAt := now.Add(-time.Hour)
+
+	// options are created with their votes, higher and flat meet the rule
+	poll := func(operator string, votes ...int) database.Poll {
+		options := []database.PollOption{
+			{Value: "Higher", MeetsRule: true},
+			{Value: "Lower"},
+			{Value: "Flat", MeetsRule: true},
+		}
+
+		for i := range votes {
+			options[i].VotesCount = votes[i]
+		}
+
+		return database.Poll{
+			Resolution: &database.Resolution{Operator: operator, Target: 100},
+			Options:    options,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		poll      database.Poll
+		price     float64
+		met       bool
+		sentiment int
+		winners   []string
+		crowd     *bool
+	}{
+		{"above met", poll(resolution.Above, 5, 1, 0), 110, true, 1, []string{"Higher", "Flat"}, ptr(true)},
+		{"above missed", poll(resolution.Above, 5, 1, 0), 90, false, -1, []string{"Lower"}, ptr(false)},
+		{"above on target", poll(resolution.Above, 1, 5, 0), 100, false, 0, []string{"Lower"}, ptr(true)},
+		{"below met", poll(resolution.Below, 1, 5, 0), 90, true, -1, []string{"Higher", "Flat"}, ptr(false)},
+		{"below missed", poll(resolution.Below, 1, 5, 0), 110, false, 1, []string{"Lower"}, ptr(true)},
+		{"tied crowd", poll(resolution.Above, 3, 3, 0), 110, true, 1, []string{"Higher", "Flat"}, nil},
+		{"no votes", poll(resolution.Above), 110, true, 1, []string{"Higher", "Flat"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome := Resolve(tt.poll, Price{Value: tt.price, At: closedAt}, now)
+
+			if outcome.Unresolvable || outcome.Met != tt.met || outcome.Sentiment != tt.sentiment {
+				t.Errorf("met, sentiment = %t, %d, want %t, %d", outcome.Met, outcome.Sentiment, tt.met, tt.sentiment)
+			}
+
+			if !slices.Equal(outcome.WinningOptions, tt.winners) {
+				t.Errorf("WinningOptions = %q, want %q", outcome.WinningOptions, tt.winners)
+			}
+
+			switch {
+			case tt.crowd == nil && outcome.CrowdCorrect != nil:
+				t.Errorf("CrowdCorrect = %t, want nil", *outcome.CrowdCorrect)
+			case tt.crowd != nil && (outcome.CrowdCorrect == nil || *outcome.CrowdCorrect != *tt.crowd):
+				t.Errorf("CrowdCorrect = %v, want %t", outcome.CrowdCorrect, *tt.crowd)
+			}
+
+			if outcome.Price != tt.price || !outcome.PricedAt.Equal(closedAt) || !outcome.ResolvedAt.Equal(now) {
+				t.Errorf("outcome does not record the price: %+v", outcome)
+			}
+		})
+	}
+}
+
+// staticSource serves a single price per symbol
+type staticSource map[string]Price
+
+func (s staticSource) PriceAt(_ context.Context, symbol string, _ time.Time) (Price, error) {
+	price, ok := s[symbol]
+	if !ok {
+		return Price{}, ErrNoPrice
+	}
+
+	return price, nil
+}
+
+func TestResolvePolls(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	now := time.Now().UTC()
+
+	insert := func(ticker string, closedFor time.Duration) int64 {
+		t.Helper()
+
+		closesAt := now.Add(-closedFor)
+		opensAt := closesAt.Add(-time.Hour)
+
+		id, err := store.InsertPoll(ctx, database.Poll{
+			Title:      "Will " + ticker + " close above 100?",
+			Ticker:     ticker,
+			OpensAt:    &opensAt,
+			ClosesAt:   &closesAt,
+			Resolution: &database.Resolution{Operator: resolution.Above, Target: 100},
+			Options:    []database.PollOption{{Value: "Yes", MeetsRule: true}, {Value: "No"}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return id
+	}
+
+	var (
+		priced  = insert("AAPL", 2*time.Hour)
+		pending = insert("MSFT", 2*time.Hour)
+		expired = insert("TSLA", 48*time.Hour)
+		recent  = insert("NVDA", time.Minute)
+	)
+
+	source := staticSource{
+		"AAPL": {Symbol: "AAPL", At: now.Add(-2 * time.Hour), Value: 120},
+		"NVDA": {Symbol: "NVDA", At: now, Value: 120},
+	}
+
+	resolved, err := ResolvePolls(ctx, store, source, time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved != 2 {
+		t.Errorf("resolved %d polls, want 2", resolved)
+	}
+
+	outcomeOf := func(id int64) *database.Outcome {
+		t.Helper()
+
+		poll, err := store.GetPollByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return poll.Outcome
+	}
+
+	if outcome := outcomeOf(priced); outcome == nil || !outcome.Met || !slices.Equal(outcome.WinningOptions, []string{"Yes"}) {
+		t.Errorf("priced poll outcome = %+v, want the rule met", outcome)
+	}
+
+	if outcome := outcomeOf(pending); outcome != nil {
+		t.Errorf("pending poll outcome = %+v, want it retried later", outcome)
+	}
+
+	if outcome := outcomeOf(expired); outcome == nil || !outcome.Unresolvable || len(outcome.WinningOptions) != 0 {
+		t.Errorf("expired poll outcome = %+v, want it unresolvable", outcome)
+	}
+
+	if outcome := outcomeOf(recent); outcome != nil {
+		t.Errorf("recent poll outcome = %+v, want it within the delay", outcome)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,236 @@
+package sessions
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	utils "github.com/rawnly/votestreet/internal/util"
+	"github.com/rawnly/votestreet/pkg/useragent"
+)
+
+const (
+	indexKeyPrefix = "index:"
+	// indexTTL is refreshed on every login, stale entries are pruned on read
+	indexTTL = 30 * 24 * time.Hour
+)
+
+// Info describes an active session,
+// the session ID itself is never exposed
+type Info struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"-"`
+	Browser   string    `json:"browser"`
+	OS        string    `json:"os"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+// record is the stored form of Info, including the session ID
+type record struct {
+	Info
+	SessionID string `json:"session_id"`
+}
+
+// Index keeps track of the sessions of each user
+// alongside the sessions in the same storage
+type Index struct {
+	store *session.Store
+	mu    sync.Mutex
+}
+
+func NewIndex(store *session.Store) *Index {
+	return &Index{store: store}
+}
+
+// Add records the session of the request for the given user
+func (i *Index) Add(c *fiber.Ctx, oauthID string, sessionID string) error {
+	ua := useragent.FromCtx(c)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entries, err := i.load(oauthID)
+	if err != nil {
+		return err
+	}
+
+	entries = append(entries, Info{
+		ID:        utils.RandomStringPrefixed("ses_", 12),
+		SessionID: sessionID,
+		Browser:   ua.Name,
+		OS:        ua.OS,
+		Device:    device(ua),
+		IP:        c.IP(),
+		CreatedAt: time.Now(),
+	})
+
+	return i.save(oauthID, entries)
+}
+
+// List returns the active sessions of the user,
+// `current` is the session ID of the caller
+func (i *Index) List(oauthID string, current string) ([]Info, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entries, err := i.prune(oauthID)
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range entries {
+		entries[idx].Current = entries[idx].SessionID == current
+	}
+
+	return entries, nil
+}
+
+// Revoke destroys a session by its public ID, reports whether it was found
+func (i *Index) Revoke(oauthID string, id string) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entries, err := i.load(oauthID)
+	if err != nil {
+		return false, err
+	}
+
+	for idx, entry := range entries {
+		if entry.ID != id {
+			continue
+		}
+
+		if err := i.store.Delete(entry.SessionID); err != nil {
+			return false, err
+		}
+
+		return true, i.save(oauthID, append(entries[:idx], entries[idx+1:]...))
+	}
+
+	return false, nil
+}
+
+// RevokeAll destroys every session of the user
+func (i *Index) RevokeAll(oauthID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entries, err := i.load(oauthID)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := i.store.Delete(entry.SessionID); err != nil {
+			return err
+		}
+	}
+
+	return i.store.Storage.Delete(indexKeyPrefix + oauthID)
+}
+
+// Remove drops a session from the index, used on logout
+func (i *Index) Remove(oauthID string, sessionID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	entries, err := i.load(oauthID)
+	if err != nil {
+		return err
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.SessionID != sessionID {
+			kept = append(kept, entry)
+		}
+	}
+
+	return i.save(oauthID, kept)
+}
+
+// prune drops the entries whose session expired
+func (i *Index) prune(oauthID string) ([]Info, error) {
+	entries, err := i.load(oauthID)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		data, err := i.store.Storage.Get(entry.SessionID)
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			kept = append(kept, entry)
+		}
+	}
+
+	if len(kept) != len(entries) {
+		if err := i.save(oauthID, kept); err != nil {
+			return nil, err
+		}
+	}
+
+	return kept, nil
+}
+
+func (i *Index) load(oauthID string) ([]Info, error) {
+	data, err := i.store.Storage.Get(indexKeyPrefix + oauthID)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var records []record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, err
+	}
+
+	entries := make([]Info, len(records))
+	for idx, r := range records {
+		entries[idx] = r.Info
+		entries[idx].SessionID = r.SessionID
+	}
+
+	return entries, nil
+}
+
+func (i *Index) save(oauthID string, entries []Info) error {
+	if len(entries) == 0 {
+		return i.store.Storage.Delete(indexKeyPrefix + oauthID)
+	}
+
+	records := make([]record, len(entries))
+	for idx, entry := range entries {
+		records[idx] = record{Info: entry, SessionID: entry.SessionID}
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	return i.store.Storage.Set(indexKeyPrefix+oauthID, data, indexTTL)
+}
+
+func device(ua *useragent.UserAgent) string {
+	switch {
+	case ua.Device != "":
+		return ua.Device
+	case ua.Mobile:
+		return "mobile"
+	case ua.Tablet:
+		return "tablet"
+	case ua.Desktop:
+		return "desktop"
+	default:
+		return "unknown"
+	}
+}
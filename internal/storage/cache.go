@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetJSON decodes a cached value, reports false on cache miss
+func GetJSON(storage fiber.Storage, key string, v any) (bool, error) {
+	data, err := storage.Get(key)
+	if err != nil || data == nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetJSON encodes and caches a value for the given duration
+func SetJSON(storage fiber.Storage, key string, v any, exp time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return storage.Set(key, data, exp)
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// memoryGCInterval is how often expired keys are evicted,
+// expired keys are never returned in between
+const memoryGCInterval = 10 * time.Second
+
+var _ fiber.Storage = (*Memory)(nil)
+
+type memoryEntry struct {
+	value []byte
+	// expiresAt is zero when the key never expires
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// Memory is an in-process fiber.Storage with expiration,
+// data is lost on restart and not shared across instances
+type Memory struct {
+	mu      sync.RWMutex
+	entries map[string]memoryEntry
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewMemory() *Memory {
+	m := &Memory{
+		entries: make(map[string]memoryEntry),
+		done:    make(chan struct{}),
+	}
+
+	go m.gc()
+
+	return m
+}
+
+func (m *Memory) Get(key string) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok || entry.expired(time.Now()) {
+		return nil, nil
+	}
+
+	return append([]byte(nil), entry.value...), nil
+}
+
+// Set stores the value, a zero expiration never expires
+func (m *Memory) Set(key string, value []byte, exp time.Duration) error {
+	if len(key) == 0 || len(value) == 0 {
+		return nil
+	}
+
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if exp > 0 {
+		entry.expiresAt = time.Now().Add(exp)
+	}
+
+	m.mu.Lock()
+	m.entries[key] = entry
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) Delete(key string) error {
+	if len(key) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	delete(m.entries, key)
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *Memory) Reset() error {
+	m.mu.Lock()
+	m.entries = make(map[string]memoryEntry)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Close stops the eviction of expired keys
+func (m *Memory) Close() error {
+	m.once.Do(func() {
+		close(m.done)
+	})
+
+	return nil
+}
+
+func (m *Memory) gc() {
+	ticker := time.NewTicker(memoryGCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for key, entry := range m.entries {
+				if entry.expired(now) {
+					delete(m.entries, key)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
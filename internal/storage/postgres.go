@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	postgresGCInterval = 1 * time.Minute
+	postgresTimeout    = 5 * time.Second
+)
+
+var _ fiber.Storage = (*Postgres)(nil)
+
+// Postgres is a fiber.Storage backed by the kv_storage table,
+// each redis database index is a separate namespace
+type Postgres struct {
+	db   int
+	done chan struct{}
+	once sync.Once
+}
+
+func NewPostgres(db int) *Postgres {
+	p := &Postgres{
+		db:   db,
+		done: make(chan struct{}),
+	}
+
+	go p.gc()
+
+	return p
+}
+
+func (p *Postgres) Get(key string) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	var value []byte
+	err := database.Get().QueryRowContext(
+		ctx,
+		"SELECT value FROM kv_storage WHERE db = $1 AND key = $2 AND (expires_at IS NULL OR expires_at > now())",
+		p.db,
+		key,
+	).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+// Set stores the value, a zero expiration never expires
+func (p *Postgres) Set(key string, value []byte, exp time.Duration) error {
+	if len(key) == 0 || len(value) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	var milliseconds *int64
+	if exp > 0 {
+		ms := exp.Milliseconds()
+		milliseconds = &ms
+	}
+
+	_, err := database.Get().ExecContext(
+		ctx,
+		`
+		INSERT INTO kv_storage (db, key, value, expires_at)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+		ON CONFLICT (db, key) DO UPDATE SET
+			value = excluded.value,
+			expires_at = excluded.expires_at
+		`,
+		p.db,
+		key,
+		value,
+		milliseconds,
+	)
+
+	return err
+}
+
+func (p *Postgres) Delete(key string) error {
+	if len(key) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	_, err := database.Get().ExecContext(ctx, "DELETE FROM kv_storage WHERE db = $1 AND key = $2", p.db, key)
+	return err
+}
+
+func (p *Postgres) Reset() error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	_, err := database.Get().ExecContext(ctx, "DELETE FROM kv_storage WHERE db = $1", p.db)
+	return err
+}
+
+// Close stops the eviction of expired keys, the pool is owned by the database package
+func (p *Postgres) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+
+	return nil
+}
+
+func (p *Postgres) gc() {
+	ticker := time.NewTicker(postgresGCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+			if _, err := database.Get().ExecContext(ctx, "DELETE FROM kv_storage WHERE db = $1 AND expires_at <= now()", p.db); err != nil {
+				log.Error().Err(err).Int("db", p.db).Msg("Failed to evict expired keys")
+			}
+			cancel()
+		}
+	}
+}
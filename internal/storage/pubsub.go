@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// pubsubDB is the database index of the client used for pub/sub,
+// channels are shared across databases
+func pubsubDB() int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return options.Databases.PubSub
+}
+
+// localBufferSize matches the channel size of the redis client
+const localBufferSize = 100
+
+type localMessage struct {
+	channel string
+	payload []byte
+}
+
+// localSubscriber receives the messages published in process,
+// used by the memory and postgres backends
+type localSubscriber struct {
+	pattern  string
+	messages chan localMessage
+}
+
+var (
+	localSubscribers   = make(map[*localSubscriber]struct{})
+	localSubscribersMu sync.RWMutex
+)
+
+// Publish sends the payload to every instance subscribed to the channel,
+// only the redis backend reaches other instances
+func Publish(ctx context.Context, channel string, payload []byte) error {
+	if backend != BackendRedis {
+		publishLocal(channel, payload)
+		return nil
+	}
+
+	return Redis(pubsubDB()).Conn().Publish(ctx, channel, payload).Err()
+}
+
+// Subscribe calls the handler for every message published on channels
+// matching the pattern, blocks until the context is cancelled.
+// Lost connections are re-established by the client.
+func Subscribe(ctx context.Context, pattern string, handler func(channel string, payload []byte)) error {
+	if backend != BackendRedis {
+		return subscribeLocal(ctx, pattern, handler)
+	}
+
+	pubsub := Redis(pubsubDB()).Conn().PSubscribe(ctx, pattern)
+	defer pubsub.Close()
+
+	// wait for the subscription confirmation
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			handler(message.Channel, []byte(message.Payload))
+		}
+	}
+}
+
+func publishLocal(channel string, payload []byte) {
+	localSubscribersMu.RLock()
+	defer localSubscribersMu.RUnlock()
+
+	for subscriber := range localSubscribers {
+		if matched, _ := path.Match(subscriber.pattern, channel); !matched {
+			continue
+		}
+
+		select {
+		case subscriber.messages <- localMessage{channel: channel, payload: payload}:
+		default:
+			log.Warn().Str("channel", channel).Msg("Subscriber is full, message dropped")
+		}
+	}
+}
+
+func subscribeLocal(ctx context.Context, pattern string, handler func(channel string, payload []byte)) error {
+	subscriber := &localSubscriber{
+		pattern:  pattern,
+		messages: make(chan localMessage, localBufferSize),
+	}
+
+	localSubscribersMu.Lock()
+	localSubscribers[subscriber] = struct{}{}
+	localSubscribersMu.Unlock()
+
+	defer func() {
+		localSubscribersMu.Lock()
+		delete(localSubscribers, subscriber)
+		localSubscribersMu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message := <-subscriber.messages:
+			handler(message.channel, message.payload)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"sync"
 
 	"github.com/gofiber/storage/redis/v3"
@@ -17,11 +19,24 @@ func Redis(db int) *redis.Storage {
 		return &storage
 	}
 
-	storage := redis.New(redis.Config{
-		Host:     "localhost",
-		Port:     6379,
+	mu.Lock()
+	redisConfig := redis.Config{
+		Host:     options.Host,
+		Port:     options.Port,
+		Username: options.Username,
+		Password: options.Password,
 		Database: db,
-	})
+	}
+
+	if options.TLS {
+		redisConfig.TLSConfig = &tls.Config{
+			ServerName: options.Host,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	mu.Unlock()
+
+	storage := redis.New(redisConfig)
 
 	mu.Lock()
 	storageMap[db] = *storage
@@ -30,8 +45,25 @@ func Redis(db int) *redis.Storage {
 	return Redis(db)
 }
 
-func IsRedisHealthy(ctx context.Context) bool {
+func isRedisHealthy(ctx context.Context) bool {
 	cmd := Redis(0).Conn().Ping(ctx)
 
 	return cmd.Err() == nil
 }
+
+// closeRedis closes every redis client
+func closeRedis() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var errs []error
+	for db, storage := range storageMap {
+		if err := storage.Close(); err != nil {
+			errs = append(errs, err)
+		}
+
+		delete(storageMap, db)
+	}
+
+	return errors.Join(errs...)
+}
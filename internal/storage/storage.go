@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rawnly/votestreet/internal/config"
+	"github.com/rawnly/votestreet/internal/database"
+)
+
+// Storage backends
+const (
+	BackendRedis    = "redis"
+	BackendMemory   = "memory"
+	BackendPostgres = "postgres"
+)
+
+var (
+	options = config.Default().Redis
+	backend = BackendRedis
+
+	// backends holds the memory and postgres storages, keyed by database index
+	backends   = make(map[int]fiber.Storage)
+	backendsMu sync.Mutex
+)
+
+// Configure selects the backend and the redis connection settings,
+// must be called before the first storage is created
+func Configure(storage config.Storage, redis config.Redis) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	backend = storage.Backend
+	options = redis
+}
+
+// Get returns the storage of the database index on the configured backend,
+// memory and postgres storages keep each index in a separate namespace
+func Get(db int) fiber.Storage {
+	switch backend {
+	case BackendMemory, BackendPostgres:
+		backendsMu.Lock()
+		defer backendsMu.Unlock()
+
+		if storage, ok := backends[db]; ok {
+			return storage
+		}
+
+		var storage fiber.Storage = NewMemory()
+		if backend == BackendPostgres {
+			storage = NewPostgres(db)
+		}
+
+		backends[db] = storage
+
+		return storage
+	default:
+		return Redis(db)
+	}
+}
+
+// IsHealthy reports whether the configured backend is reachable
+func IsHealthy(ctx context.Context) bool {
+	switch backend {
+	case BackendMemory:
+		return true
+	case BackendPostgres:
+		return database.Get() != nil && database.Get().PingContext(ctx) == nil
+	default:
+		return isRedisHealthy(ctx)
+	}
+}
+
+// Close closes every storage and redis client
+func Close() error {
+	backendsMu.Lock()
+	var errs []error
+	for db, storage := range backends {
+		if err := storage.Close(); err != nil {
+			errs = append(errs, err)
+		}
+
+		delete(backends, db)
+	}
+	backendsMu.Unlock()
+
+	if err := closeRedis(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
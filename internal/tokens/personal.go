@@ -0,0 +1,28 @@
+package tokens
+
+import (
+	"strings"
+
+	utils "github.com/rawnly/votestreet/internal/util"
+	"github.com/rawnly/votestreet/pkg/scope"
+)
+
+const (
+	ScopePollsRead  = scope.PollsRead
+	ScopePollsWrite = scope.PollsWrite
+	ScopeVotesWrite = scope.VotesWrite
+
+	PersonalTokenPrefix = "vst_"
+)
+
+// NewPersonalToken generates a personal access token and its hash,
+// only the hash is meant to be stored
+func NewPersonalToken() (token string, hash string) {
+	token = utils.RandomStringPrefixed(PersonalTokenPrefix, 40)
+	return token, utils.Hash(token)
+}
+
+// IsPersonalToken tells personal access tokens apart from signed access tokens
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
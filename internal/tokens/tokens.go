@@ -0,0 +1,299 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/gofiber/fiber/v2"
+	utils "github.com/rawnly/votestreet/internal/util"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	Issuer = "votestreet"
+
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	refreshTokenPrefix = "rt_"
+	refreshKeyPrefix   = "refresh:"
+	familyKeyPrefix    = "family:"
+	userKeyPrefix      = "families:"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrMissingKey   = errors.New("token signing key is empty")
+)
+
+// Pair is the response of a token grant
+type Pair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshEntry is the server side state of a refresh token,
+// every rotation of the same login shares the family
+type refreshEntry struct {
+	OAuthID   string    `json:"oauth_id"`
+	Family    string    `json:"family"`
+	Used      bool      `json:"used"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Service issues signed access tokens and rotating refresh tokens
+type Service struct {
+	key     []byte
+	signer  jose.Signer
+	storage fiber.Storage
+	mu      sync.Mutex
+}
+
+func New(key string, storage fiber.Storage) (*Service, error) {
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.HS256, Key: []byte(key)},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{
+		key:     []byte(key),
+		signer:  signer,
+		storage: storage,
+	}, nil
+}
+
+// Issue starts a new token family for the given user
+func (s *Service) Issue(oauthID string) (*Pair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.issue(oauthID, utils.RandomID(24))
+}
+
+// Verify validates an access token and returns the user OAuth ID
+func (s *Service) Verify(accessToken string) (string, error) {
+	token, err := jwt.ParseSigned(accessToken, []jose.SignatureAlgorithm{jose.HS256})
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	var claims jwt.Claims
+	if err := token.Claims(s.key, &claims); err != nil {
+		return "", ErrInvalidToken
+	}
+
+	if err := claims.Validate(jwt.Expected{Issuer: Issuer}); err != nil {
+		return "", ErrInvalidToken
+	}
+
+	return claims.Subject, nil
+}
+
+// Refresh rotates a refresh token, presenting an already rotated
+// token revokes the whole family
+func (s *Service) Refresh(refreshToken string) (*Pair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.lookup(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Used {
+		log.Warn().Str("oauth_id", entry.OAuthID).Str("family", entry.Family).Msg("Refresh token reuse detected")
+
+		if err := s.storage.Delete(familyKeyPrefix + entry.Family); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrInvalidToken
+	}
+
+	entry.Used = true
+	if err := s.save(refreshToken, *entry); err != nil {
+		return nil, err
+	}
+
+	return s.issue(entry.OAuthID, entry.Family)
+}
+
+// Revoke invalidates the refresh token family, unknown tokens are ignored
+func (s *Service) Revoke(refreshToken string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, err := s.lookup(refreshToken)
+	if errors.Is(err, ErrInvalidToken) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return s.storage.Delete(familyKeyPrefix + entry.Family)
+}
+
+// RevokeAll invalidates every refresh token family of the user,
+// access tokens already issued expire within AccessTokenTTL
+func (s *Service) RevokeAll(oauthID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	families, err := s.families(oauthID)
+	if err != nil {
+		return err
+	}
+
+	for _, family := range families {
+		if err := s.storage.Delete(familyKeyPrefix + family); err != nil {
+			return err
+		}
+	}
+
+	return s.storage.Delete(userKeyPrefix + oauthID)
+}
+
+// families returns the token families of the user, the lock must be held
+func (s *Service) families(oauthID string) ([]string, error) {
+	data, err := s.storage.Get(userKeyPrefix + oauthID)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var families []string
+	if err := json.Unmarshal(data, &families); err != nil {
+		return nil, err
+	}
+
+	return families, nil
+}
+
+// addFamily records the family of the user and drops the revoked or expired ones,
+// the lock must be held
+func (s *Service) addFamily(oauthID, family string) error {
+	families, err := s.families(oauthID)
+	if err != nil {
+		return err
+	}
+
+	live := []string{family}
+	for _, existing := range families {
+		if existing == family {
+			continue
+		}
+
+		data, err := s.storage.Get(familyKeyPrefix + existing)
+		if err != nil {
+			return err
+		}
+
+		if data != nil {
+			live = append(live, existing)
+		}
+	}
+
+	data, err := json.Marshal(live)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.Set(userKeyPrefix+oauthID, data, RefreshTokenTTL)
+}
+
+// issue signs a token pair of the family, the lock must be held
+func (s *Service) issue(oauthID, family string) (*Pair, error) {
+	now := time.Now()
+
+	accessToken, err := jwt.Signed(s.signer).Claims(jwt.Claims{
+		ID:       utils.RandomID(16),
+		Issuer:   Issuer,
+		Subject:  oauthID,
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+	}).Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := utils.RandomStringPrefixed(refreshTokenPrefix, 48)
+	entry := refreshEntry{
+		OAuthID:   oauthID,
+		Family:    family,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	}
+
+	if err := s.save(refreshToken, entry); err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.Set(familyKeyPrefix+family, []byte(oauthID), RefreshTokenTTL); err != nil {
+		return nil, err
+	}
+
+	if err := s.addFamily(oauthID, family); err != nil {
+		return nil, err
+	}
+
+	return &Pair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+func (s *Service) lookup(refreshToken string) (*refreshEntry, error) {
+	data, err := s.storage.Get(refreshKeyPrefix + utils.Hash(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, ErrInvalidToken
+	}
+
+	var entry refreshEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(entry.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	family, err := s.storage.Get(familyKeyPrefix + entry.Family)
+	if err != nil {
+		return nil, err
+	}
+
+	// the family was revoked
+	if family == nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &entry, nil
+}
+
+func (s *Service) save(refreshToken string, entry refreshEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.Set(refreshKeyPrefix+utils.Hash(refreshToken), data, time.Until(entry.ExpiresAt))
+}
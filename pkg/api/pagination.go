@@ -0,0 +1,13 @@
+package api
+
+// Page sizes of listings
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Page is a page of a listing, NextCursor is empty on the last page
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,307 @@
+// Package api holds the request payloads of the HTTP API and their validation rules,
+// shared by the server and its clients
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rawnly/votestreet/pkg/resolution"
+)
+
+// Limits enforced on poll payloads
+const (
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 2000
+	MaxOptionLength      = 100
+	MinOptions           = 2
+	MaxOptions           = 20
+)
+
+// CreatePollRequest is the payload of POST /api/v1/polls
+type CreatePollRequest struct {
+	Title       string              `json:"title"`
+	Description *string             `json:"description"`
+	Ticker      string              `json:"ticker"`
+	Options     []PollOptionRequest `json:"options"`
+	OpensAt     *time.Time          `json:"opens_at"`
+	ClosesAt    *time.Time          `json:"closes_at"`
+	Draft       bool                `json:"draft"`
+	LockVotes   bool                `json:"lock_votes"`
+
+	Resolution *ResolutionRule `json:"resolution"`
+}
+
+// Sentiments of an option, the direction its voters expect
+const (
+	SentimentBearish = -1
+	SentimentNeutral = 0
+	SentimentBullish = 1
+)
+
+// PollOptionRequest is an option of a CreatePollRequest,
+// a bare string is a neutral option
+type PollOptionRequest struct {
+	Value     string `json:"value"`
+	Sentiment int    `json:"sentiment"`
+	// MeetsRule marks the options that win when the resolution rule is met,
+	// the others win when it is not
+	MeetsRule bool `json:"meets_rule"`
+}
+
+func (o *PollOptionRequest) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*o = PollOptionRequest{}
+		return json.Unmarshal(data, &o.Value)
+	}
+
+	type plain PollOptionRequest
+	return json.Unmarshal(data, (*plain)(o))
+}
+
+// ResolutionRule resolves a poll against the price of its ticker at closes_at,
+// the target defaults to the price when the poll is created
+type ResolutionRule struct {
+	Operator string   `json:"operator"`
+	Target   *float64 `json:"target"`
+}
+
+func (r *CreatePollRequest) Validate() error {
+	var errs fieldErrors
+
+	r.Title = strings.TrimSpace(r.Title)
+	errs.length("title", r.Title, 1, MaxTitleLength)
+
+	if r.Description != nil {
+		description := strings.TrimSpace(*r.Description)
+		r.Description = &description
+		errs.length("description", description, 0, MaxDescriptionLength)
+	}
+
+	checkTicker(&errs, "ticker", &r.Ticker)
+	if r.Ticker == "" {
+		errs.add("ticker", "is required")
+	}
+
+	if len(r.Options) < MinOptions || len(r.Options) > MaxOptions {
+		errs.add("options", "must have between %d and %d options", MinOptions, MaxOptions)
+	}
+
+	var (
+		seen    = make(map[string]bool, len(r.Options))
+		meeting int
+	)
+
+	for i := range r.Options {
+		option := &r.Options[i]
+		option.Value = strings.TrimSpace(option.Value)
+
+		field := "options[" + strconv.Itoa(i) + "]"
+		errs.length(field, option.Value, 1, MaxOptionLength)
+
+		if seen[option.Value] {
+			errs.add(field, "is a duplicate")
+		}
+
+		if option.Sentiment < SentimentBearish || option.Sentiment > SentimentBullish {
+			errs.add(field+".sentiment", "must be %d (bearish), %d (neutral) or %d (bullish)", SentimentBearish, SentimentNeutral, SentimentBullish)
+		}
+
+		if option.MeetsRule {
+			meeting++
+
+			if r.Resolution == nil {
+				errs.add(field+".meets_rule", "requires a resolution rule")
+			}
+		}
+
+		seen[option.Value] = true
+	}
+
+	r.OpensAt, r.ClosesAt = utc(r.OpensAt), utc(r.ClosesAt)
+	validateSchedule(&errs, r.OpensAt, r.ClosesAt)
+
+	if rule := r.Resolution; rule != nil {
+		rule.Operator = strings.ToLower(strings.TrimSpace(rule.Operator))
+		if !slices.Contains(resolution.Operators, rule.Operator) {
+			errs.add("resolution.operator", "must be one of %s", strings.Join(resolution.Operators, ", "))
+		}
+
+		if rule.Target != nil && !(*rule.Target > 0 && !math.IsInf(*rule.Target, 1)) {
+			errs.add("resolution.target", "must be a positive price")
+		}
+
+		if r.ClosesAt == nil {
+			errs.add("closes_at", "is required to resolve the poll")
+		}
+
+		if meeting == 0 || meeting == len(r.Options) {
+			errs.add("options", "some but not all options must meet the resolution rule")
+		}
+	}
+
+	return errs.err()
+}
+
+// UpdatePollRequest is the payload of PATCH /api/v1/polls/:id,
+// omitted fields are left untouched and a null closes_at clears it
+type UpdatePollRequest struct {
+	Draft    *bool      `json:"draft"`
+	OpensAt  *time.Time `json:"opens_at"`
+	ClosesAt NullTime   `json:"closes_at"`
+}
+
+func (r *UpdatePollRequest) Validate() error {
+	var errs fieldErrors
+
+	if r.Draft == nil && r.OpensAt == nil && !r.ClosesAt.Set {
+		errs.add("body", "at least one of draft, opens_at or closes_at is required")
+	}
+
+	r.OpensAt, r.ClosesAt.Time = utc(r.OpensAt), utc(r.ClosesAt.Time)
+	validateSchedule(&errs, r.OpensAt, r.ClosesAt.Time)
+
+	return errs.err()
+}
+
+// NullTime tells an omitted timestamp apart from an explicit null,
+// Set is true whenever the field is present
+type NullTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+func (t *NullTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+
+	if bytes.Equal(data, []byte("null")) {
+		t.Time = nil
+		return nil
+	}
+
+	return json.Unmarshal(data, &t.Time)
+}
+
+// VoteRequest is the payload of POST /api/v1/polls/:id/vote
+type VoteRequest struct {
+	Value string `json:"value"`
+}
+
+func (r *VoteRequest) Validate() error {
+	var errs fieldErrors
+
+	r.Value = strings.TrimSpace(r.Value)
+	errs.length("value", r.Value, 1, MaxOptionLength)
+
+	return errs.err()
+}
+
+// Sort orders of poll listings
+const (
+	SortNewest = "newest"
+	SortVotes  = "votes_count"
+)
+
+// pollStatuses are the statuses a listing can be filtered by
+var pollStatuses = []string{"draft", "scheduled", "open", "closed"}
+
+// ListPollsRequest is the query of GET /api/v1/polls and GET /api/v1/polls/public,
+// From and To bound the creation time
+type ListPollsRequest struct {
+	Cursor string     `query:"cursor"`
+	Ticker string     `query:"ticker"`
+	Status string     `query:"status"`
+	From   *time.Time `query:"from"`
+	To     *time.Time `query:"to"`
+	Sort   string     `query:"sort"`
+	Limit  int        `query:"limit"`
+}
+
+func (r *ListPollsRequest) Validate() error {
+	var errs fieldErrors
+
+	r.Cursor = strings.TrimSpace(r.Cursor)
+
+	checkTicker(&errs, "ticker", &r.Ticker)
+
+	r.Status = strings.ToLower(strings.TrimSpace(r.Status))
+	if r.Status != "" && !slices.Contains(pollStatuses, r.Status) {
+		errs.add("status", "must be one of %s", strings.Join(pollStatuses, ", "))
+	}
+
+	r.From, r.To = utc(r.From), utc(r.To)
+	if r.From != nil && r.To != nil && !r.To.After(*r.From) {
+		errs.add("to", "must be after from")
+	}
+
+	switch r.Sort = strings.ToLower(strings.TrimSpace(r.Sort)); r.Sort {
+	case "":
+		r.Sort = SortNewest
+	case SortNewest, SortVotes:
+	default:
+		errs.add("sort", "must be one of %s, %s", SortNewest, SortVotes)
+	}
+
+	switch {
+	case r.Limit == 0:
+		r.Limit = DefaultPageSize
+	case r.Limit < 0 || r.Limit > MaxPageSize:
+		errs.add("limit", "must be between 1 and %d", MaxPageSize)
+	}
+
+	return errs.err()
+}
+
+// MaxSearchLength bounds the length of search queries
+const MaxSearchLength = 200
+
+// SearchRequest is the query of GET /api/v1/search
+type SearchRequest struct {
+	Query string `query:"q"`
+	Limit int    `query:"limit"`
+}
+
+func (r *SearchRequest) Validate() error {
+	var errs fieldErrors
+
+	r.Query = strings.TrimSpace(r.Query)
+	errs.length("q", r.Query, 1, MaxSearchLength)
+
+	switch {
+	case r.Limit == 0:
+		r.Limit = DefaultPageSize
+	case r.Limit < 0 || r.Limit > MaxPageSize:
+		errs.add("limit", "must be between 1 and %d", MaxPageSize)
+	}
+
+	return errs.err()
+}
+
+func validateSchedule(errs *fieldErrors, opensAt, closesAt *time.Time) {
+	if closesAt == nil {
+		return
+	}
+
+	if !closesAt.After(time.Now()) {
+		errs.add("closes_at", "must be in the future")
+	}
+
+	if opensAt != nil && !closesAt.After(*opensAt) {
+		errs.add("closes_at", "must be after opens_at")
+	}
+}
+
+// utc drops the offset, timestamps are stored in UTC
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,289 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rawnly/votestreet/pkg/resolution"
+)
+
+// invalidFields returns the fields reported by a validation error
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	var validationErr ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %T: %v", err, err)
+	}
+
+	fields := make([]string, len(validationErr))
+	for i, field := range validationErr {
+		fields[i] = field.Field
+	}
+
+	return fields
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestCreatePollRequestValidate(t *testing.T) {
+	now := time.Now()
+
+	valid := func() CreatePollRequest {
+		return CreatePollRequest{
+			Title:   "Will AAPL close higher?",
+			Ticker:  "aapl",
+			Options: []PollOptionRequest{{Value: "Bullish", Sentiment: SentimentBullish}, {Value: "Bearish", Sentiment: SentimentBearish}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *CreatePollRequest)
+		fields []string
+	}{
+		{"valid", func(r *CreatePollRequest) {}, nil},
+		{"blank title", func(r *CreatePollRequest) { r.Title = "   " }, []string{"title"}},
+		{"long title", func(r *CreatePollRequest) { r.Title = strings.Repeat("a", MaxTitleLength+1) }, []string{"title"}},
+		{"long description", func(r *CreatePollRequest) { r.Description = ptr(strings.Repeat("a", MaxDescriptionLength+1)) }, []string{"description"}},
+		{"missing ticker", func(r *CreatePollRequest) { r.Ticker = "" }, []string{"ticker"}},
+		{"malformed ticker", func(r *CreatePollRequest) { r.Ticker = "1AAPL" }, []string{"ticker"}},
+		{"one option", func(r *CreatePollRequest) { r.Options = r.Options[:1] }, []string{"options"}},
+		{"blank option", func(r *CreatePollRequest) { r.Options[1].Value = " " }, []string{"options[1]"}},
+		{"duplicate option", func(r *CreatePollRequest) { r.Options[1].Value = " Bullish" }, []string{"options[1]"}},
+		{"neutral option", func(r *CreatePollRequest) { r.Options[1].Sentiment = SentimentNeutral }, nil},
+		{"unknown sentiment", func(r *CreatePollRequest) { r.Options[0].Sentiment = 2 }, []string{"options[0].sentiment"}},
+		{"closes in the past", func(r *CreatePollRequest) { r.ClosesAt = ptr(now.Add(-time.Hour)) }, []string{"closes_at"}},
+		{"closes before opening", func(r *CreatePollRequest) {
+			r.OpensAt, r.ClosesAt = ptr(now.Add(2*time.Hour)), ptr(now.Add(time.Hour))
+		}, []string{"closes_at"}},
+		{"resolution", func(r *CreatePollRequest) {
+			r.ClosesAt = ptr(now.Add(time.Hour))
+			r.Resolution = &ResolutionRule{Operator: " Above ", Target: ptr(100.0)}
+			r.Options[0].MeetsRule = true
+		}, nil},
+		{"resolution without closes_at", func(r *CreatePollRequest) {
+			r.Resolution = &ResolutionRule{Operator: resolution.Below}
+			r.Options[1].MeetsRule = true
+		}, []string{"closes_at"}},
+		{"unknown operator", func(r *CreatePollRequest) {
+			r.ClosesAt = ptr(now.Add(time.Hour))
+			r.Resolution = &ResolutionRule{Operator: "equal"}
+			r.Options[0].MeetsRule = true
+		}, []string{"resolution.operator"}},
+		{"negative target", func(r *CreatePollRequest) {
+			r.ClosesAt = ptr(now.Add(time.Hour))
+			r.Resolution = &ResolutionRule{Operator: resolution.Above, Target: ptr(-1.0)}
+			r.Options[0].MeetsRule = true
+		}, []string{"resolution.target"}},
+		{"no option meets the rule", func(r *CreatePollRequest) {
+			r.ClosesAt = ptr(now.Add(time.Hour))
+			r.Resolution = &ResolutionRule{Operator: resolution.Above}
+		}, []string{"options"}},
+		{"every option meets the rule", func(r *CreatePollRequest) {
+			r.ClosesAt = ptr(now.Add(time.Hour))
+			r.Resolution = &ResolutionRule{Operator: resolution.Above}
+			r.Options[0].MeetsRule, r.Options[1].MeetsRule = true, true
+		}, []string{"options"}},
+		{"meets_rule without resolution", func(r *CreatePollRequest) {
+			r.Options[1].MeetsRule = true
+		}, []string{"options[1].meets_rule"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.modify(&r)
+
+			if fields := invalidFields(t, r.Validate()); !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestCreatePollRequestValidateNormalizes(t *testing.T) {
+	r := CreatePollRequest{
+		Title:    "  Will BRK-B close higher?  ",
+		Ticker:   " brk/b ",
+		Options:  []PollOptionRequest{{Value: " Yes "}, {Value: "No"}},
+		ClosesAt: ptr(time.Now().Add(time.Hour).In(time.FixedZone("CET", 3600))),
+	}
+
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Title != "Will BRK-B close higher?" || r.Ticker != "BRK.B" || r.Options[0].Value != "Yes" {
+		t.Errorf("fields were not normalized: %+v", r)
+	}
+
+	if r.ClosesAt.Location() != time.UTC {
+		t.Errorf("closes_at is in %s, want UTC", r.ClosesAt.Location())
+	}
+}
+
+func TestPollOptionRequestUnmarshalJSON(t *testing.T) {
+	var r CreatePollRequest
+	if err := json.Unmarshal([]byte(`{"options": ["Yes", {"value": "Calls", "sentiment": 1}, {"value": "Puts", "sentiment": -1, "meets_rule": true}]}`), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PollOptionRequest{{Value: "Yes"}, {Value: "Calls", Sentiment: SentimentBullish}, {Value: "Puts", Sentiment: SentimentBearish, MeetsRule: true}}
+	if !slices.Equal(r.Options, want) {
+		t.Errorf("options = %+v, want %+v", r.Options, want)
+	}
+
+	if err := json.Unmarshal([]byte(`{"options": [1]}`), &r); err == nil {
+		t.Error("expected an error for a numeric option")
+	}
+}
+
+func TestUpdatePollRequestValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"empty", `{}`, []string{"body"}},
+		{"draft", `{"draft": false}`, nil},
+		{"clear closes_at", `{"closes_at": null}`, nil},
+		{"closes_at", `{"closes_at": "` + now.Add(time.Hour).Format(time.RFC3339) + `"}`, nil},
+		{"closes in the past", `{"closes_at": "` + now.Add(-time.Hour).Format(time.RFC3339) + `"}`, []string{"closes_at"}},
+		{"closes before opening", `{"opens_at": "` + now.Add(2*time.Hour).Format(time.RFC3339) + `", "closes_at": "` + now.Add(time.Hour).Format(time.RFC3339) + `"}`, []string{"closes_at"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r UpdatePollRequest
+			if err := json.Unmarshal([]byte(tt.body), &r); err != nil {
+				t.Fatal(err)
+			}
+
+			if fields := invalidFields(t, r.Validate()); !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestNullTimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		set  bool
+		time bool
+	}{
+		{"omitted", `{}`, false, false},
+		{"null", `{"closes_at": null}`, true, false},
+		{"timestamp", `{"closes_at": "2030-01-02T15:04:05Z"}`, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r UpdatePollRequest
+			if err := json.Unmarshal([]byte(tt.body), &r); err != nil {
+				t.Fatal(err)
+			}
+
+			if r.ClosesAt.Set != tt.set || (r.ClosesAt.Time != nil) != tt.time {
+				t.Errorf("closes_at = %+v, want set %t and time %t", r.ClosesAt, tt.set, tt.time)
+			}
+		})
+	}
+
+	var r UpdatePollRequest
+	if err := json.Unmarshal([]byte(`{"closes_at": "tomorrow"}`), &r); err == nil {
+		t.Error("expected an error for a malformed timestamp")
+	}
+}
+
+func TestVoteRequestValidate(t *testing.T) {
+	tests := []struct {
+		value  string
+		fields []string
+	}{
+		{"Yes", nil},
+		{"  ", []string{"value"}},
+		{strings.Repeat("a", MaxOptionLength), nil},
+		{strings.Repeat("a", MaxOptionLength+1), []string{"value"}},
+	}
+
+	for _, tt := range tests {
+		r := VoteRequest{Value: tt.value}
+		if fields := invalidFields(t, r.Validate()); !slices.Equal(fields, tt.fields) {
+			t.Errorf("Validate(%q) invalid fields = %v, want %v", tt.value, fields, tt.fields)
+		}
+	}
+}
+
+func TestListPollsRequestValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		request ListPollsRequest
+		fields  []string
+		sort    string
+		limit   int
+	}{
+		{"defaults", ListPollsRequest{}, nil, SortNewest, DefaultPageSize},
+		{"sort by votes", ListPollsRequest{Sort: " VOTES_COUNT ", Limit: 5}, nil, SortVotes, 5},
+		{"unknown sort", ListPollsRequest{Sort: "oldest"}, []string{"sort"}, "oldest", DefaultPageSize},
+		{"status", ListPollsRequest{Status: "Open"}, nil, SortNewest, DefaultPageSize},
+		{"unknown status", ListPollsRequest{Status: "archived"}, []string{"status"}, SortNewest, DefaultPageSize},
+		{"malformed ticker", ListPollsRequest{Ticker: "A_B"}, []string{"ticker"}, SortNewest, DefaultPageSize},
+		{"inverted range", ListPollsRequest{From: ptr(now), To: ptr(now.Add(-time.Hour))}, []string{"to"}, SortNewest, DefaultPageSize},
+		{"negative limit", ListPollsRequest{Limit: -1}, []string{"limit"}, SortNewest, -1},
+		{"large limit", ListPollsRequest{Limit: MaxPageSize + 1}, []string{"limit"}, SortNewest, MaxPageSize + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.request
+
+			if fields := invalidFields(t, r.Validate()); !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+
+			if r.Sort != tt.sort || r.Limit != tt.limit {
+				t.Errorf("sort, limit = %q, %d, want %q, %d", r.Sort, r.Limit, tt.sort, tt.limit)
+			}
+		})
+	}
+}
+
+func TestSearchRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request SearchRequest
+		fields  []string
+	}{
+		{"valid", SearchRequest{Query: "apple"}, nil},
+		{"blank query", SearchRequest{Query: "  "}, []string{"q"}},
+		{"long query", SearchRequest{Query: strings.Repeat("a", MaxSearchLength+1)}, []string{"q"}},
+		{"large limit", SearchRequest{Query: "apple", Limit: MaxPageSize + 1}, []string{"limit"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.request
+
+			if fields := invalidFields(t, r.Validate()); !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
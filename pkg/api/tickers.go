@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/rawnly/votestreet/pkg/ticker"
+)
+
+// MaxTickerPrefixLength bounds autocomplete prefixes,
+// long enough for the start of a company name
+const MaxTickerPrefixLength = 50
+
+// checkTicker normalizes and validates an optional symbol
+func checkTicker(errs *fieldErrors, field string, symbol *string) {
+	*symbol = ticker.Normalize(*symbol)
+	if *symbol != "" && !ticker.Valid(*symbol) {
+		errs.add(field, "must be a symbol like AAPL or BRK.B")
+	}
+}
+
+// TickersRequest is the query of GET /api/v1/tickers,
+// the prefix matches symbols and company names
+type TickersRequest struct {
+	Prefix string `query:"prefix"`
+	Limit  int    `query:"limit"`
+}
+
+func (r *TickersRequest) Validate() error {
+	var errs fieldErrors
+
+	r.Prefix = strings.TrimSpace(r.Prefix)
+	errs.length("prefix", r.Prefix, 1, MaxTickerPrefixLength)
+
+	switch {
+	case r.Limit == 0:
+		r.Limit = DefaultPageSize
+	case r.Limit < 0 || r.Limit > MaxPageSize:
+		errs.add("limit", "must be between 1 and %d", MaxPageSize)
+	}
+
+	return errs.err()
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTickersRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		request TickersRequest
+		fields  []string
+		limit   int
+	}{
+		{"symbol", TickersRequest{Prefix: " aa "}, nil, DefaultPageSize},
+		{"company name", TickersRequest{Prefix: "Berkshire Hathaway", Limit: 5}, nil, 5},
+		{"blank prefix", TickersRequest{Prefix: "  "}, []string{"prefix"}, DefaultPageSize},
+		{"long prefix", TickersRequest{Prefix: strings.Repeat("a", MaxTickerPrefixLength+1)}, []string{"prefix"}, DefaultPageSize},
+		{"large limit", TickersRequest{Prefix: "a", Limit: MaxPageSize + 1}, []string{"limit"}, MaxPageSize + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.request
+
+			if fields := invalidFields(t, r.Validate()); !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+
+			if r.Limit != tt.limit {
+				t.Errorf("limit = %d, want %d", r.Limit, tt.limit)
+			}
+		})
+	}
+}
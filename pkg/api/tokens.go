@@ -0,0 +1,52 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rawnly/votestreet/pkg/scope"
+)
+
+// MaxTokenNameLength bounds the name of a personal access token
+const MaxTokenNameLength = 100
+
+// CreateTokenRequest is the payload of POST /api/v1/users/me/tokens,
+// the token never expires without expires_at
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r *CreateTokenRequest) Validate() error {
+	var errs fieldErrors
+
+	r.Name = strings.TrimSpace(r.Name)
+	errs.length("name", r.Name, 1, MaxTokenNameLength)
+
+	if len(r.Scopes) == 0 {
+		errs.add("scopes", "must have at least one of %s", strings.Join(scope.All, ", "))
+	}
+
+	seen := make(map[string]bool, len(r.Scopes))
+	for i, s := range r.Scopes {
+		field := "scopes[" + strconv.Itoa(i) + "]"
+
+		switch {
+		case !scope.Valid(s):
+			errs.add(field, "must be one of %s", strings.Join(scope.All, ", "))
+		case seen[s]:
+			errs.add(field, "is a duplicate")
+		}
+
+		seen[s] = true
+	}
+
+	r.ExpiresAt = utc(r.ExpiresAt)
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		errs.add("expires_at", "must be in the future")
+	}
+
+	return errs.err()
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rawnly/votestreet/pkg/scope"
+)
+
+func TestCreateTokenRequestValidate(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		request CreateTokenRequest
+		fields  []string
+	}{
+		{"valid", CreateTokenRequest{Name: "ci", Scopes: []string{scope.PollsRead}}, nil},
+		{"expiring", CreateTokenRequest{Name: "ci", Scopes: []string{scope.PollsRead}, ExpiresAt: ptr(now.Add(time.Hour))}, nil},
+		{"blank name", CreateTokenRequest{Name: "  ", Scopes: []string{scope.PollsRead}}, []string{"name"}},
+		{"long name", CreateTokenRequest{Name: strings.Repeat("a", MaxTokenNameLength+1), Scopes: []string{scope.PollsRead}}, []string{"name"}},
+		{"no scopes", CreateTokenRequest{Name: "ci"}, []string{"scopes"}},
+		{"unknown scope", CreateTokenRequest{Name: "ci", Scopes: []string{scope.PollsRead, "admin"}}, []string{"scopes[1]"}},
+		{"duplicate scope", CreateTokenRequest{Name: "ci", Scopes: []string{scope.VotesWrite, scope.VotesWrite}}, []string{"scopes[1]"}},
+		{"expired", CreateTokenRequest{Name: "ci", Scopes: []string{scope.PollsRead}, ExpiresAt: ptr(now.Add(-time.Hour))}, []string{"expires_at"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.request
+
+			if fields := invalidFields(t, r.Validate()); !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestCreateTokenRequestValidateNormalizes(t *testing.T) {
+	r := CreateTokenRequest{
+		Name:      "  ci  ",
+		Scopes:    []string{scope.PollsRead},
+		ExpiresAt: ptr(time.Now().Add(time.Hour).In(time.FixedZone("UTC-8", -8*3600))),
+	}
+
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Name != "ci" || r.ExpiresAt.Location() != time.UTC {
+		t.Errorf("fields were not normalized: %+v", r)
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why a field of a request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, field := range e {
+		messages[i] = field.Field + ": " + field.Message
+	}
+
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+// Validator is implemented by every request,
+// Validate trims and normalizes the fields in place before checking them
+type Validator interface {
+	Validate() error
+}
+
+// fieldErrors collects the errors of a request
+type fieldErrors []FieldError
+
+func (e *fieldErrors) add(field, format string, args ...any) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// length checks the number of characters of a trimmed value
+func (e *fieldErrors) length(field, value string, min, max int) {
+	switch n := utf8.RuneCountInString(value); {
+	case n < min && min == 1:
+		e.add(field, "is required")
+	case n < min:
+		e.add(field, "must be at least %d characters", min)
+	case n > max:
+		e.add(field, "must be at most %d characters", max)
+	}
+}
+
+func (e fieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return ValidationError(e)
+}
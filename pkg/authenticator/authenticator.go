@@ -2,51 +2,94 @@ package authenticator
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
-
-	"go4.org/syncutil"
+	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
 )
 
-type Authenticator struct {
-	*oidc.Provider
-	oauth2.Config
-}
+const (
+	ProviderGoogle    = "google"
+	ProviderGitHub    = "github"
+	ProviderMicrosoft = "microsoft"
+	ProviderGitLab    = "gitlab"
+)
 
-type AuthenticatorsService struct {
-	Google *Authenticator
-}
+var (
+	ErrNoIDToken     = errors.New("no id_token field in oauth2 token")
+	ErrNoProviders   = errors.New("no oauth providers configured")
+	ErrEmailNotFound = errors.New("no email found for the authenticated account")
+	ErrInvalidNonce  = errors.New("id_token nonce does not match")
+)
 
-var once syncutil.Once
+// Identity is the provider agnostic representation
+// of an authenticated account
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	// Expiry is the expiration of the upstream credentials,
+	// zero if the provider does not expire them
+	Expiry time.Time
+}
 
-func New() (authenticators *AuthenticatorsService, err error) {
-	google, err := GetGoogleAuthenticator()
-	if err != nil {
-		return nil, err
-	}
+// Provider is an OAuth2 (or OIDC) identity provider
+type Provider interface {
+	// Name is the unique name used in the /oauth/:provider routes
+	Name() string
+	// AuthCodeURL returns the consent page URL for the given state and nonce
+	AuthCodeURL(ctx context.Context, state, nonce string, opts ...oauth2.AuthCodeOption) (string, error)
+	// Authenticate exchanges the authorization code and resolves the account identity,
+	// the nonce must match the one sent with AuthCodeURL
+	Authenticate(ctx context.Context, code, nonce string, opts ...oauth2.AuthCodeOption) (*Identity, error)
+}
 
-	authenticators = &AuthenticatorsService{
-		Google: google,
-	}
+type Authenticator struct {
+	*oidc.Provider
+	oauth2.Config
 
-	return authenticators, err
+	issuer          string
+	keySet          oidc.KeySet
+	skipIssuerCheck bool
 }
 
+// VerifyIDToken verifies the id_token signature and claims,
+// including the nonce bound to the login session
 func (a *Authenticator) VerifyIDToken(
 	ctx context.Context,
 	token *oauth2.Token,
+	nonce string,
 ) (*oidc.IDToken, error) {
 	idToken, ok := token.Extra("id_token").(string)
 	if !ok {
-		err := errors.New("no id_token field in oauth2 token")
-		return nil, err
+		return nil, ErrNoIDToken
 	}
 
 	oidcConfig := &oidc.Config{
-		ClientID: a.ClientID,
+		ClientID:        a.ClientID,
+		SkipIssuerCheck: a.skipIssuerCheck,
 	}
 
-	return a.Verifier(oidcConfig).Verify(ctx, idToken)
+	verified, err := oidc.NewVerifier(a.issuer, a.keySet, oidcConfig).Verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(verified.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrInvalidNonce
+	}
+
+	return verified, nil
+}
+
+// splitName splits a full name into first and last name
+func splitName(name string) (string, string) {
+	first, last, _ := strings.Cut(strings.TrimSpace(name), " ")
+	return first, strings.TrimSpace(last)
 }
@@ -0,0 +1,104 @@
+package authenticator
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	// DefaultRefreshInterval is how often discovery documents and key sets are refreshed
+	DefaultRefreshInterval = 1 * time.Hour
+
+	discoveryAttempts = 3
+	discoveryBackoff  = 500 * time.Millisecond
+	discoveryTimeout  = 10 * time.Second
+	// refreshTimeout bounds every attempt of a refresh and their backoff
+	refreshTimeout = discoveryAttempts*discoveryTimeout + 2*discoveryBackoff
+)
+
+// Refresher is implemented by providers caching remote metadata
+type Refresher interface {
+	// Refresh fetches the remote metadata, the previous copy
+	// is kept when the refresh fails
+	Refresh(ctx context.Context) error
+	// Ready reports whether the provider can serve logins
+	Ready() bool
+}
+
+// cachedKeySet verifies against the prefetched keys and falls back
+// to the remote key set when the issuer rotated its keys in the meantime
+type cachedKeySet struct {
+	static *oidc.StaticKeySet
+	remote *oidc.RemoteKeySet
+}
+
+func (k *cachedKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	if payload, err := k.static.VerifySignature(ctx, jwt); err == nil {
+		return payload, nil
+	}
+
+	return k.remote.VerifySignature(ctx, jwt)
+}
+
+// fetchKeySet downloads the JSON Web Key Set published by the issuer
+func fetchKeySet(ctx context.Context, jwksURL string) (*cachedKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %d", jwksURL, res.StatusCode)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make([]crypto.PublicKey, 0, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		keys = append(keys, key.Key)
+	}
+
+	return &cachedKeySet{
+		static: &oidc.StaticKeySet{PublicKeys: keys},
+		remote: oidc.NewRemoteKeySet(context.Background(), jwksURL),
+	}, nil
+}
+
+// withRetry calls fn up to `attempts` times with exponential backoff
+func withRetry[T any](ctx context.Context, attempts int, backoff time.Duration, fn func(context.Context) (T, error)) (result T, err error) {
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			case <-time.After(backoff << (attempt - 1)):
+			}
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+		result, err = fn(attemptCtx)
+		cancel()
+
+		if err == nil {
+			return result, nil
+		}
+	}
+
+	return result, err
+}
@@ -0,0 +1,132 @@
+package authenticator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Provider types
+const (
+	TypeOIDC      = "oidc"
+	TypeGitHub    = "github"
+	TypeMicrosoft = "microsoft"
+)
+
+// ProviderConfig configures a provider of the registry,
+// the type is inferred from the name of builtin providers
+type ProviderConfig struct {
+	Name         string       `yaml:"name"`
+	Type         string       `yaml:"type,omitempty"`
+	Issuer       string       `yaml:"issuer,omitempty"`
+	Tenant       string       `yaml:"tenant,omitempty"`
+	ClientID     string       `yaml:"client_id"`
+	ClientSecret string       `yaml:"client_secret"`
+	RedirectURI  string       `yaml:"redirect_uri"`
+	Scopes       []string     `yaml:"scopes,omitempty"`
+	Claims       ClaimMapping `yaml:"claims,omitempty"`
+}
+
+// WithDefaults fills the type, issuer, tenant, scopes and claims left empty
+func (c ProviderConfig) WithDefaults() ProviderConfig {
+	if c.Type == "" {
+		switch c.Name {
+		case ProviderGitHub:
+			c.Type = TypeGitHub
+		case ProviderMicrosoft:
+			c.Type = TypeMicrosoft
+		default:
+			c.Type = TypeOIDC
+		}
+	}
+
+	if c.Issuer == "" {
+		switch c.Name {
+		case ProviderGoogle:
+			c.Issuer = "https://accounts.google.com"
+		case ProviderGitLab:
+			c.Issuer = "https://gitlab.com"
+		}
+	}
+
+	if c.Type == TypeMicrosoft && c.Tenant == "" {
+		c.Tenant = "common"
+	}
+
+	if c.Type == TypeOIDC && len(c.Scopes) == 0 {
+		c.Scopes = []string{"profile", "email"}
+	}
+
+	c.Claims = c.Claims.withDefaults()
+
+	return c
+}
+
+// Validate checks the required fields, call it after WithDefaults
+func (c ProviderConfig) Validate() error {
+	var errs []error
+
+	if c.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+
+	switch c.Type {
+	case TypeOIDC:
+		if c.Issuer == "" {
+			errs = append(errs, errors.New("issuer is required"))
+		}
+	case TypeGitHub, TypeMicrosoft:
+		if c.Name != c.Type {
+			errs = append(errs, fmt.Errorf("%s providers must be named %q", c.Type, c.Type))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown type %q", c.Type))
+	}
+
+	if c.ClientID == "" {
+		errs = append(errs, errors.New("client_id is required"))
+	}
+
+	if c.ClientSecret == "" {
+		errs = append(errs, errors.New("client_secret is required"))
+	}
+
+	if c.RedirectURI == "" {
+		errs = append(errs, errors.New("redirect_uri is required"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("oauth provider %q: %w", c.Name, err)
+	}
+
+	return nil
+}
+
+// provider creates the provider described by the config
+func (c ProviderConfig) provider() Provider {
+	switch c.Type {
+	case TypeGitHub:
+		return NewGitHub(OAuth2Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURI:  c.RedirectURI,
+			Scopes:       c.Scopes,
+		})
+	case TypeMicrosoft:
+		return NewMicrosoft(c.Tenant, OAuth2Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURI:  c.RedirectURI,
+			Scopes:       c.Scopes,
+		})
+	default:
+		return NewOIDC(OIDCConfig{
+			Name:         c.Name,
+			Issuer:       c.Issuer,
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURI:  c.RedirectURI,
+			Scopes:       c.Scopes,
+			Claims:       c.Claims,
+		})
+	}
+}
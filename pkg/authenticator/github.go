@@ -0,0 +1,133 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/github"
+)
+
+const githubAPI = "https://api.github.com"
+
+type (
+	githubUser struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+
+	githubEmail struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+)
+
+// OAuth2Config configures a plain OAuth2 provider
+type OAuth2Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+}
+
+type githubProvider struct {
+	oauth2.Config
+}
+
+// NewGitHub creates a GitHub OAuth2 provider,
+// GitHub does not support OIDC so the identity is read from the REST API
+func NewGitHub(config OAuth2Config) Provider {
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"read:user", "user:email"}
+	}
+
+	return &githubProvider{
+		Config: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURI,
+			Endpoint:     github.Endpoint,
+			Scopes:       scopes,
+		},
+	}
+}
+
+func (p *githubProvider) Name() string {
+	return ProviderGitHub
+}
+
+// AuthCodeURL ignores the nonce, github does not issue id tokens
+func (p *githubProvider) AuthCodeURL(_ context.Context, state, _ string, opts ...oauth2.AuthCodeOption) (string, error) {
+	return p.Config.AuthCodeURL(state, opts...), nil
+}
+
+func (p *githubProvider) Authenticate(ctx context.Context, code, _ string, opts ...oauth2.AuthCodeOption) (*Identity, error) {
+	token, err := p.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := p.Client(ctx, token)
+
+	var user githubUser
+	if err := getJSON(client, githubAPI+"/user", &user); err != nil {
+		return nil, err
+	}
+
+	var emails []githubEmail
+	if err := getJSON(client, githubAPI+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Provider: ProviderGitHub,
+		Subject:  strconv.FormatInt(user.ID, 10),
+		Expiry:   token.Expiry,
+	}
+
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = email.Verified
+			break
+		}
+	}
+
+	if identity.Email == "" {
+		return nil, ErrEmailNotFound
+	}
+
+	identity.FirstName, identity.LastName = splitName(user.Name)
+	if identity.FirstName == "" {
+		identity.FirstName = user.Login
+	}
+
+	return identity, nil
+}
+
+func getJSON(client *http.Client, url string, v any) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
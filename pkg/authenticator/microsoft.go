@@ -0,0 +1,41 @@
+package authenticator
+
+import "fmt"
+
+// NewMicrosoft creates a Microsoft identity platform provider for the given tenant.
+//
+// Microsoft does not send `email_verified`, the `xms_edov` optional claim
+// (email domain owner verified) must be enabled on the app registration
+func NewMicrosoft(tenant string, config OAuth2Config) Provider {
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	oidcConfig := OIDCConfig{
+		Name:         ProviderMicrosoft,
+		Issuer:       fmt.Sprintf("https://login.microsoftonline.com/%s/v2.0", tenant),
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURI:  config.RedirectURI,
+		Scopes:       scopes,
+		Claims: ClaimMapping{
+			Subject:       "oid",
+			Email:         "email",
+			EmailVerified: "xms_edov",
+			FirstName:     "given_name",
+			LastName:      "family_name",
+			Name:          "name",
+		},
+	}
+
+	// multi-tenant endpoints advertise a templated issuer
+	// and every token is signed with the tenant specific one
+	switch tenant {
+	case "common", "organizations", "consumers":
+		oidcConfig.DiscoveryIssuer = "https://login.microsoftonline.com/{tenantid}/v2.0"
+		oidcConfig.SkipIssuerCheck = true
+	}
+
+	return NewOIDC(oidcConfig)
+}
@@ -0,0 +1,273 @@
+package authenticator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/rs/zerolog/log"
+	"go4.org/syncutil/singleflight"
+	"golang.org/x/oauth2"
+)
+
+// ClaimMapping tells which ID token claims hold the identity fields
+type ClaimMapping struct {
+	Subject       string `yaml:"subject,omitempty"`
+	Email         string `yaml:"email,omitempty"`
+	EmailVerified string `yaml:"email_verified,omitempty"`
+	FirstName     string `yaml:"first_name,omitempty"`
+	LastName      string `yaml:"last_name,omitempty"`
+	// Name is used as a fallback when first and last name are missing
+	Name string `yaml:"name,omitempty"`
+}
+
+// DefaultClaimMapping are the standard OIDC claims
+var DefaultClaimMapping = ClaimMapping{
+	Subject:       "sub",
+	Email:         "email",
+	EmailVerified: "email_verified",
+	FirstName:     "given_name",
+	LastName:      "family_name",
+	Name:          "name",
+}
+
+// withDefaults fills the empty claims with the standard ones
+func (m ClaimMapping) withDefaults() ClaimMapping {
+	if m.Subject == "" {
+		m.Subject = DefaultClaimMapping.Subject
+	}
+
+	if m.Email == "" {
+		m.Email = DefaultClaimMapping.Email
+	}
+
+	if m.EmailVerified == "" {
+		m.EmailVerified = DefaultClaimMapping.EmailVerified
+	}
+
+	if m.FirstName == "" {
+		m.FirstName = DefaultClaimMapping.FirstName
+	}
+
+	if m.LastName == "" {
+		m.LastName = DefaultClaimMapping.LastName
+	}
+
+	if m.Name == "" {
+		m.Name = DefaultClaimMapping.Name
+	}
+
+	return m
+}
+
+// OIDCConfig configures an OpenID Connect provider
+type OIDCConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	Scopes       []string
+	Claims       ClaimMapping
+	// DiscoveryIssuer overrides the issuer reported by the discovery document,
+	// needed by multi-tenant issuers (e.g. microsoft "common")
+	DiscoveryIssuer string
+	// SkipIssuerCheck disables the `iss` claim validation
+	SkipIssuerCheck bool
+}
+
+type oidcProvider struct {
+	config OIDCConfig
+
+	mu     sync.RWMutex
+	cached *Authenticator
+	group  singleflight.Group
+}
+
+// NewOIDC creates a provider for any OpenID Connect compliant issuer
+func NewOIDC(config OIDCConfig) Provider {
+	if config.Claims == (ClaimMapping{}) {
+		config.Claims = DefaultClaimMapping
+	}
+
+	return &oidcProvider{config: config}
+}
+
+func (p *oidcProvider) Name() string {
+	return p.config.Name
+}
+
+// authenticator returns the cached authenticator,
+// discovering the issuer on first use
+func (p *oidcProvider) authenticator(ctx context.Context) (*Authenticator, error) {
+	p.mu.RLock()
+	authenticator := p.cached
+	p.mu.RUnlock()
+
+	if authenticator != nil {
+		return authenticator, nil
+	}
+
+	if err := p.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.cached, nil
+}
+
+// Refresh re-discovers the issuer and its key set,
+// concurrent refreshes are collapsed into a single round-trip.
+// The round-trip is detached from the callers, one of them going away
+// doesn't fail the others, ctx only bounds how long this caller waits
+func (p *oidcProvider) Refresh(ctx context.Context) error {
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := p.group.Do(p.config.Name, func() (interface{}, error) {
+			refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), refreshTimeout)
+			defer cancel()
+
+			authenticator, err := withRetry(refreshCtx, discoveryAttempts, discoveryBackoff, p.discover)
+			if err != nil {
+				log.Error().Err(err).Str("provider", p.config.Name).Msg("Failed to discover oidc issuer")
+				return nil, err
+			}
+
+			p.mu.Lock()
+			p.cached = authenticator
+			p.mu.Unlock()
+
+			return nil, nil
+		})
+
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *oidcProvider) Ready() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.cached != nil
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*Authenticator, error) {
+	if p.config.DiscoveryIssuer != "" {
+		ctx = oidc.InsecureIssuerURLContext(ctx, p.config.DiscoveryIssuer)
+	}
+
+	authenticator, err := newAuthenticator(
+		ctx,
+		p.config.Issuer,
+		p.config.ClientID,
+		p.config.ClientSecret,
+		p.config.RedirectURI,
+		p.config.Scopes,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator.skipIssuerCheck = p.config.SkipIssuerCheck
+
+	return authenticator, nil
+}
+
+func (p *oidcProvider) AuthCodeURL(ctx context.Context, state, nonce string, opts ...oauth2.AuthCodeOption) (string, error) {
+	authenticator, err := p.authenticator(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return authenticator.AuthCodeURL(state, append(opts, oidc.Nonce(nonce))...), nil
+}
+
+func (p *oidcProvider) Authenticate(ctx context.Context, code, nonce string, opts ...oauth2.AuthCodeOption) (*Identity, error) {
+	authenticator, err := p.authenticator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := authenticator.Exchange(ctx, code, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := authenticator.VerifyIDToken(ctx, token, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	identity := p.config.Claims.identity(claims)
+	identity.Provider = p.config.Name
+	identity.Expiry = idToken.Expiry
+
+	if identity.Subject == "" {
+		identity.Subject = idToken.Subject
+	}
+
+	return identity, nil
+}
+
+func (m ClaimMapping) identity(claims map[string]any) *Identity {
+	identity := &Identity{
+		Subject:       claimString(claims, m.Subject),
+		Email:         claimString(claims, m.Email),
+		EmailVerified: claimBool(claims, m.EmailVerified),
+		FirstName:     claimString(claims, m.FirstName),
+		LastName:      claimString(claims, m.LastName),
+	}
+
+	if identity.FirstName == "" && identity.LastName == "" {
+		identity.FirstName, identity.LastName = splitName(claimString(claims, m.Name))
+	}
+
+	return identity
+}
+
+func claimString(claims map[string]any, key string) string {
+	if key == "" {
+		return ""
+	}
+
+	switch value := claims[key].(type) {
+	case string:
+		return value
+	case float64:
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return ""
+	}
+}
+
+func claimBool(claims map[string]any, key string) bool {
+	if key == "" {
+		return false
+	}
+
+	switch value := claims[key].(type) {
+	case bool:
+		return value
+	// some issuers send booleans as strings
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
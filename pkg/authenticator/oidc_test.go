@@ -0,0 +1,113 @@
+package authenticator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestIssuer serves a discovery document and an empty key set,
+// discovery requests wait for the delay
+func newTestIssuer(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var discoveries atomic.Int32
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		discoveries.Add(1)
+		time.Sleep(delay)
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                server.URL,
+			"authorization_endpoint":                server.URL + "/authorize",
+			"token_endpoint":                        server.URL + "/token",
+			"jwks_uri":                              server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"keys": []}`))
+	})
+
+	return server, &discoveries
+}
+
+func TestNewAuthenticatorScopes(t *testing.T) {
+	server, _ := newTestIssuer(t, 0)
+
+	tests := []struct {
+		name       string
+		configured []string
+		want       []string
+	}{
+		{"none", nil, []string{"openid"}},
+		{"appended", []string{"email", "profile"}, []string{"email", "profile", "openid"}},
+		{"already configured", []string{"openid", "email"}, []string{"openid", "email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// spare capacity would let an append write into the configured array
+			configured := make([]string, len(tt.configured), len(tt.configured)+1)
+			copy(configured, tt.configured)
+
+			authenticator, err := newAuthenticator(context.Background(), server.URL, "client", "secret", server.URL+"/callback", configured)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(authenticator.Config.Scopes, tt.want) {
+				t.Errorf("scopes = %v, want %v", authenticator.Config.Scopes, tt.want)
+			}
+
+			if spare := configured[:cap(configured)][len(configured)]; spare != "" {
+				t.Errorf("the configured slice was written to: %q", spare)
+			}
+		})
+	}
+}
+
+func TestOIDCRefreshOutlivesCancelledCaller(t *testing.T) {
+	server, discoveries := newTestIssuer(t, 200*time.Millisecond)
+
+	provider := NewOIDC(OIDCConfig{Name: "test", Issuer: server.URL, ClientID: "client"}).(*oidcProvider)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := provider.AuthCodeURL(cancelled, "state", "nonce")
+		first <- err
+	}()
+
+	// the second login joins the discovery started by the first one
+	time.Sleep(50 * time.Millisecond)
+	second := make(chan error, 1)
+	go func() {
+		_, err := provider.AuthCodeURL(context.Background(), "state", "nonce")
+		second <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-first; err == nil {
+		t.Error("the cancelled login succeeded")
+	}
+
+	if err := <-second; err != nil {
+		t.Errorf("the concurrent login failed: %v", err)
+	}
+
+	if !provider.Ready() || discoveries.Load() != 1 {
+		t.Errorf("ready = %t after %d discoveries, want a single one", provider.Ready(), discoveries.Load())
+	}
+}
@@ -0,0 +1,128 @@
+package authenticator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Registry holds the configured providers, keyed by name
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+	names     []string
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	registry := &Registry{
+		providers: make(map[string]Provider),
+	}
+
+	for _, provider := range providers {
+		registry.Register(provider)
+	}
+
+	return registry
+}
+
+// Register adds a provider, replacing any provider with the same name
+func (r *Registry) Register(provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.providers[provider.Name()]; !ok {
+		r.names = append(r.names, provider.Name())
+	}
+
+	r.providers[provider.Name()] = provider
+}
+
+func (r *Registry) Get(name string) (Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	provider, ok := r.providers[name]
+	return provider, ok
+}
+
+// Names returns the provider names in registration order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]string(nil), r.names...)
+}
+
+// Ready reports whether every provider can serve logins
+func (r *Registry) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, provider := range r.providers {
+		if refresher, ok := provider.(Refresher); ok && !refresher.Ready() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Refresh refreshes the metadata of every provider
+func (r *Registry) Refresh(ctx context.Context) {
+	r.mu.RLock()
+	providers := make([]Provider, 0, len(r.providers))
+	for _, provider := range r.providers {
+		providers = append(providers, provider)
+	}
+	r.mu.RUnlock()
+
+	for _, provider := range providers {
+		if refresher, ok := provider.(Refresher); ok {
+			// errors are logged by the provider, the stale metadata keeps serving
+			_ = refresher.Refresh(ctx)
+		}
+	}
+}
+
+// Start warms up the providers and refreshes them every interval
+// until the context is cancelled
+func (r *Registry) Start(ctx context.Context, interval time.Duration) {
+	r.Refresh(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Refresh(ctx)
+		}
+	}
+}
+
+// New creates a registry from the provider configs
+func New(configs []ProviderConfig) (*Registry, error) {
+	registry := NewRegistry()
+
+	for _, config := range configs {
+		config = config.WithDefaults()
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+
+		if _, ok := registry.Get(config.Name); ok {
+			return nil, fmt.Errorf("oauth provider %q is already registered", config.Name)
+		}
+
+		registry.Register(config.provider())
+	}
+
+	if len(registry.Names()) == 0 {
+		return nil, ErrNoProviders
+	}
+
+	return registry, nil
+}
@@ -2,24 +2,42 @@ package authenticator
 
 import (
 	"context"
+	"slices"
 
 	"github.com/coreos/go-oidc/v3/oidc"
-	"github.com/voxelite-ai/env"
 	"golang.org/x/oauth2"
 )
 
 // newAuthenticator creates a new authenticator for the specified issuer, client ID, client secret, redirect URI, and scopes.
 // The function returns an error if the provider cannot be created.
-func newAuthenticator(issuer, clientID, clientSecret, redirectURI string, scopes []string) (*Authenticator, error) {
-	provider, err := oidc.NewProvider(context.Background(), issuer)
+func newAuthenticator(ctx context.Context, issuer, clientID, clientSecret, redirectURI string, scopes []string) (*Authenticator, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
 	if err != nil {
 		return nil, err
 	}
 
-	scopes = append(scopes, oidc.ScopeOpenID)
+	var metadata struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if err := provider.Claims(&metadata); err != nil {
+		return nil, err
+	}
+
+	keySet, err := fetchKeySet(ctx, metadata.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// copied, appending could write into the configured slice
+	scopes = slices.Clone(scopes)
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append(scopes, oidc.ScopeOpenID)
+	}
 
 	authenticator := &Authenticator{
 		Provider: provider,
+		issuer:   issuer,
+		keySet:   keySet,
 		Config: oauth2.Config{
 			ClientID:     clientID,
 			ClientSecret: clientSecret,
@@ -31,13 +49,3 @@ func newAuthenticator(issuer, clientID, clientSecret, redirectURI string, scopes
 
 	return authenticator, nil
 }
-
-func GetGoogleAuthenticator() (*Authenticator, error) {
-	return newAuthenticator(
-		"https://accounts.google.com",
-		env.String("GOOGLE_AUTH_CLIENT_ID"),
-		env.String("GOOGLE_AUTH_CLIENT_SECRET"),
-		env.String("GOOGLE_AUTH_REDIRECT_URI"),
-		[]string{"profile", "email"},
-	)
-}
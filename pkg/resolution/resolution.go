@@ -0,0 +1,25 @@
+// Package resolution holds the rules polls are resolved with,
+// shared by the API payloads and the resolver
+package resolution
+
+// Operators of a rule, comparing the closing price to the target
+const (
+	Above = "above"
+	Below = "below"
+)
+
+// Operators are the valid operators
+var Operators = []string{Above, Below}
+
+// Met reports whether the price meets the rule,
+// a price on the target meets neither operator
+func Met(operator string, price, target float64) bool {
+	switch operator {
+	case Above:
+		return price > target
+	case Below:
+		return price < target
+	default:
+		return false
+	}
+}
@@ -0,0 +1,25 @@
+package resolution
+
+import "testing"
+
+func TestMet(t *testing.T) {
+	tests := []struct {
+		operator string
+		price    float64
+		want     bool
+	}{
+		{Above, 101, true},
+		{Above, 100, false},
+		{Above, 99, false},
+		{Below, 99, true},
+		{Below, 100, false},
+		{Below, 101, false},
+		{"equal", 100, false},
+	}
+
+	for _, tt := range tests {
+		if got := Met(tt.operator, tt.price, 100); got != tt.want {
+			t.Errorf("Met(%q, %v, 100) = %t, want %t", tt.operator, tt.price, got, tt.want)
+		}
+	}
+}
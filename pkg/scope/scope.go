@@ -0,0 +1,23 @@
+// Package scope lists the permissions a personal access token can be granted,
+// shared by the API payloads and the token issuer
+package scope
+
+import "slices"
+
+const (
+	PollsRead  = "polls:read"
+	PollsWrite = "polls:write"
+	VotesWrite = "votes:write"
+)
+
+// All are the scopes a personal access token can be granted
+var All = []string{
+	PollsRead,
+	PollsWrite,
+	VotesWrite,
+}
+
+// Valid reports whether the scope is known
+func Valid(s string) bool {
+	return slices.Contains(All, s)
+}
@@ -0,0 +1,23 @@
+package scope
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  bool
+	}{
+		{PollsRead, true},
+		{PollsWrite, true},
+		{VotesWrite, true},
+		{"polls:admin", false},
+		{"POLLS:READ", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Valid(tt.scope); got != tt.want {
+			t.Errorf("Valid(%q) = %t, want %t", tt.scope, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// Package ticker holds the rules of stock symbols,
+// shared by the API payloads, the database and the price sources
+package ticker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// MaxLength is the width of the ticker columns
+const MaxLength = 12
+
+// symbolRegex matches a normalized symbol, e.g. AAPL or BRK.B
+var symbolRegex = regexp.MustCompile(`^[A-Z][A-Z0-9]{0,7}(\.[A-Z0-9]{1,3})?$`)
+
+// separators are the share class separators used by data vendors
+var separators = strings.NewReplacer("-", ".", "/", ".", " ", "")
+
+// Normalize upper-cases a symbol and spells share classes with a dot,
+// BRK-B and brk/b both become BRK.B
+func Normalize(symbol string) string {
+	return separators.Replace(strings.ToUpper(strings.TrimSpace(symbol)))
+}
+
+// Valid reports whether a normalized symbol is well-formed
+func Valid(symbol string) bool {
+	return symbolRegex.MatchString(symbol)
+}
@@ -0,0 +1,54 @@
+package ticker
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   string
+	}{
+		{"AAPL", "AAPL"},
+		{" aapl ", "AAPL"},
+		{"brk.b", "BRK.B"},
+		{"BRK-B", "BRK.B"},
+		{"brk/b", "BRK.B"},
+		{"BRK B", "BRKB"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.symbol); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.symbol, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   bool
+	}{
+		{"AAPL", true},
+		{"F", true},
+		{"BRK.B", true},
+		{"RDS.ABC", true},
+		{"GOOGLEAB", true},
+		{"GOOGLEABC", false},
+		{"BRK.ABCD", false},
+		{"BRK.", false},
+		{"3M", false},
+		{"aapl", false},
+		{"AA_PL", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := Valid(tt.symbol); got != tt.want {
+			t.Errorf("Valid(%q) = %t, want %t", tt.symbol, got, tt.want)
+		}
+
+		if len(tt.symbol) > MaxLength && Valid(tt.symbol) {
+			t.Errorf("Valid(%q) accepts a symbol longer than %d", tt.symbol, MaxLength)
+		}
+	}
+}
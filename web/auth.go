@@ -0,0 +1,186 @@
+package router
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/internal/tokens"
+	utils "github.com/rawnly/votestreet/internal/util"
+	"github.com/rs/zerolog/log"
+)
+
+// principal is the authenticated caller,
+// only personal access tokens are restricted by scopes
+type principal struct {
+	OAuthID  string
+	Personal bool
+	Scopes   []string
+}
+
+// Can reports whether the principal was granted the scope
+func (p *principal) Can(scope string) bool {
+	return !p.Personal || slices.Contains(p.Scopes, scope)
+}
+
+// bearerToken returns the token of the Authorization header, if any
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+// identify resolves the caller from the bearer token (personal or signed access token)
+// or, when no Authorization header is sent, from the session cookie
+func identify(c *fiber.Ctx, store *session.Store, issuer *tokens.Service, users database.UserStore) (*principal, error) {
+	if token, ok := bearerToken(c); ok {
+		if tokens.IsPersonalToken(token) {
+			return identifyPersonalToken(c, token, users)
+		}
+
+		oauthID, err := issuer.Verify(token)
+		if err != nil {
+			return nil, fiber.ErrUnauthorized
+		}
+
+		return &principal{OAuthID: oauthID}, nil
+	}
+
+	session, err := store.Get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthID, ok := session.Get("user_id").(string)
+	if !ok {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	return &principal{OAuthID: oauthID}, nil
+}
+
+func identifyPersonalToken(c *fiber.Ctx, token string, users database.UserStore) (*principal, error) {
+	pat, err := users.GetPersonalAccessTokenByHash(c.Context(), utils.Hash(token))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if pat.ExpiresAt != nil && time.Now().After(*pat.ExpiresAt) {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	if err := users.TouchPersonalAccessToken(c.Context(), pat.ID); err != nil {
+		log.Error().Err(err).Int("token_id", pat.ID).Msg("Failed to update token last use")
+	}
+
+	return &principal{
+		OAuthID:  pat.OAuthID,
+		Personal: true,
+		Scopes:   pat.Scopes,
+	}, nil
+}
+
+func authMiddleware(store *session.Store, issuer *tokens.Service, users database.UserStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		caller, err := identify(c, store, issuer, users)
+		if err != nil {
+			return err
+		}
+
+		// the token outlived its user
+		user, err := users.GetUserByOAuthID(c.Context(), caller.OAuthID)
+		if errors.Is(err, database.ErrNotFound) {
+			return fiber.ErrUnauthorized
+		}
+
+		if err != nil {
+			return err
+		}
+
+		c.Locals("user", user)
+		c.Locals("principal", caller)
+
+		return c.Next()
+	}
+}
+
+// voterID identifies the voter, anonymous voters are told apart by IP,
+// invalid credentials are rejected rather than treated as anonymous
+func voterID(c *fiber.Ctx, store *session.Store, issuer *tokens.Service, users database.UserStore) (string, error) {
+	caller, err := identify(c, store, issuer, users)
+	switch {
+	case errors.Is(err, fiber.ErrUnauthorized) && c.Get(fiber.HeaderAuthorization) == "":
+		return utils.Hash(c.IP()), nil
+	case err != nil:
+		return "", err
+	case !caller.Can(tokens.ScopeVotesWrite):
+		return "", fiber.ErrForbidden
+	default:
+		return caller.OAuthID, nil
+	}
+}
+
+// isAuthor reports whether the caller wrote the poll,
+// anonymous callers and invalid credentials are not authors
+func isAuthor(c *fiber.Ctx, poll database.Poll, store *session.Store, issuer *tokens.Service, users database.UserStore) (bool, error) {
+	if poll.UserID == nil {
+		return false, nil
+	}
+
+	caller, err := identify(c, store, issuer, users)
+	if errors.Is(err, fiber.ErrUnauthorized) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if !caller.Can(tokens.ScopePollsRead) {
+		return false, nil
+	}
+
+	user, err := users.GetUserByOAuthID(c.Context(), caller.OAuthID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return user.ID == *poll.UserID, nil
+}
+
+// requireScope rejects personal access tokens missing the scope,
+// must run after authMiddleware
+func requireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !c.Locals("principal").(*principal).Can(scope) {
+			return fiber.ErrForbidden
+		}
+
+		return c.Next()
+	}
+}
+
+// denyPersonalTokens restricts a route to interactive logins,
+// must run after authMiddleware
+func denyPersonalTokens(c *fiber.Ctx) error {
+	if c.Locals("principal").(*principal).Personal {
+		return fiber.ErrForbidden
+	}
+
+	return c.Next()
+}
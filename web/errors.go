@@ -0,0 +1,106 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/pkg/api"
+	"github.com/rs/zerolog/log"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 error response
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+
+	// Errors lists the invalid fields of a rejected request
+	Errors []api.FieldError `json:"errors,omitempty"`
+}
+
+// ErrorHandler renders every error as application/problem+json,
+// internal errors are logged and never exposed
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	status, detail := classify(err)
+
+	if status >= fiber.StatusInternalServerError {
+		log.Error().Err(err).Str("request_id", c.GetRespHeader(fiber.HeaderXRequestID)).Msg("Request failed")
+	}
+
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  c.OriginalURL(),
+		RequestID: c.GetRespHeader(fiber.HeaderXRequestID),
+	}
+
+	var validationErr api.ValidationError
+	if errors.As(err, &validationErr) {
+		problem.Errors = validationErr
+	}
+
+	return c.Status(status).JSON(problem, problemContentType)
+}
+
+// classify maps an error to its status code and a detail safe to expose
+func classify(err error) (int, string) {
+	var (
+		fiberErr  *fiber.Error
+		domainErr *database.Error
+		invalid   api.ValidationError
+		numErr    *strconv.NumError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		timeErr   *time.ParseError
+	)
+
+	switch {
+	case errors.As(err, &fiberErr):
+		if fiberErr.Message == http.StatusText(fiberErr.Code) {
+			return fiberErr.Code, ""
+		}
+
+		return fiberErr.Code, fiberErr.Message
+	case errors.As(err, &invalid):
+		return fiber.StatusBadRequest, "request validation failed"
+	case errors.As(err, &domainErr):
+		return domainStatus(domainErr.Kind), domainErr.Message
+	case errors.As(err, &numErr):
+		return fiber.StatusBadRequest, "invalid number " + strconv.Quote(numErr.Num)
+	case errors.As(err, &syntaxErr):
+		return fiber.StatusBadRequest, "malformed JSON body"
+	case errors.As(err, &typeErr):
+		return fiber.StatusBadRequest, "invalid type for " + typeErr.Field
+	case errors.As(err, &timeErr):
+		return fiber.StatusBadRequest, "invalid timestamp " + strconv.Quote(timeErr.Value) + ", expected RFC 3339"
+	default:
+		return fiber.StatusInternalServerError, ""
+	}
+}
+
+func domainStatus(kind error) int {
+	switch kind {
+	case database.ErrNotFound:
+		return fiber.StatusNotFound
+	case database.ErrConflict:
+		return fiber.StatusConflict
+	case database.ErrForbidden:
+		return fiber.StatusForbidden
+	case database.ErrValidation:
+		return fiber.StatusBadRequest
+	default:
+		return fiber.StatusInternalServerError
+	}
+}
@@ -1,67 +1,254 @@
 package router
 
 import (
-	"crypto/sha256"
+	"bufio"
+	"context"
 	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/rawnly/votestreet/internal/config"
 	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/internal/jobs"
+	"github.com/rawnly/votestreet/internal/live"
+	"github.com/rawnly/votestreet/internal/market"
+	"github.com/rawnly/votestreet/internal/sessions"
 	"github.com/rawnly/votestreet/internal/storage"
+	"github.com/rawnly/votestreet/internal/tokens"
 	utils "github.com/rawnly/votestreet/internal/util"
+	"github.com/rawnly/votestreet/pkg/api"
 	"github.com/rawnly/votestreet/pkg/authenticator"
+	"github.com/rawnly/votestreet/pkg/ticker"
 	"github.com/rs/zerolog/log"
-)
-
-type (
-	OauthProvider string
-	GoogleUser    struct {
-		ID        string `json:"sub"`
-		Email     string `json:"email"`
-		Name      string `json:"name"`
-		Verified  bool   `json:"email_verified"`
-		LastName  string `json:"family_name"`
-		FirstName string `json:"given_name"`
-	}
+	"golang.org/x/oauth2"
 )
 
 const (
-	ProviderGoogle OauthProvider = "google"
+	// resultsCacheTTL bounds staleness if an invalidation is lost
+	resultsCacheTTL = 1 * time.Minute
+
+	streamHeartbeat    = 15 * time.Second
+	socketWriteTimeout = 5 * time.Second
+	publishTimeout     = 5 * time.Second
+	// publishQueueSize bounds the polls waiting for their tallies to be published
+	publishQueueSize = 1024
 )
 
-func authMiddleware(store *session.Store) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		session, err := store.Get(c)
-		if err != nil {
-			return err
-		}
+func resultsCacheKey(pollID int64) string {
+	return fmt.Sprintf("results:%d", pollID)
+}
 
-		oauthID, ok := session.Get("user_id").(string)
-		if !ok {
-			return c.SendStatus(fiber.StatusUnauthorized)
-		}
+// publishResults pushes the current tallies to the stream subscribers of every instance
+func publishResults(votes database.VoteStore, hub *live.Hub, pollID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
 
-		user, err := database.GetUserByOAuthID(c.Context(), oauthID)
-		if err != nil {
-			return err
+	results, err := votes.GetPollResults(ctx, pollID)
+	if err != nil {
+		log.Error().Err(err).Int64("poll_id", pollID).Msg("Failed to compute poll results")
+		return
+	}
+
+	payload, err := json.Marshal(results)
+	if err != nil {
+		return
+	}
+
+	if err := hub.Publish(ctx, pollID, payload); err != nil {
+		log.Error().Err(err).Int64("poll_id", pollID).Msg("Failed to publish poll results")
+	}
+}
+
+// publishQueued publishes the tallies of the queued polls until the context is done
+func publishQueued(ctx context.Context, votes database.VoteStore, hub *live.Hub, queue <-chan int64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pollID := <-queue:
+			publishResults(votes, hub, pollID)
 		}
+	}
+}
+
+// streamResults reads the poll ID of the route and the current results to send first
+func streamResults(c *fiber.Ctx, votes database.VoteStore) (int64, []byte, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	results, err := votes.GetPollResults(c.Context(), int64(id))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	initial, err := json.Marshal(results)
+	if err != nil {
+		return 0, nil, err
+	}
 
-		c.Locals("user", user)
+	return int64(id), initial, nil
+}
 
-		return c.Next()
+// closeSocket sends a close frame, the connection is closed by the caller returning
+func closeSocket(conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(socketWriteTimeout)); err != nil {
+		log.Debug().Err(err).Msg("Failed to close websocket")
 	}
 }
 
-func Init(app *fiber.App) error {
+// writeEvent writes a server-sent event and flushes it to the client
+func writeEvent(w *bufio.Writer, event string, data []byte) error {
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// userFromIdentity maps a provider identity into a database user,
+// google subjects are stored as-is for backwards compatibility
+func userFromIdentity(identity *authenticator.Identity) database.User {
+	oauthID := identity.Subject
+	if identity.Provider != authenticator.ProviderGoogle {
+		oauthID = identity.Provider + "|" + identity.Subject
+	}
+
+	return database.User{
+		OAuthID:   oauthID,
+		Email:     identity.Email,
+		FirstName: identity.FirstName,
+		LastName:  identity.LastName,
+	}
+}
+
+// Options are the dependencies of the router
+type Options struct {
+	// Workers runs the background workers until the context of Init is done
+	Workers   *jobs.Group
+	Databases config.RedisDatabases
+	Providers *authenticator.Registry
+	Issuer    *tokens.Service
+
+	Polls     database.PollStore
+	Votes     database.VoteStore
+	Users     database.UserStore
+	Tickers   database.TickerStore
+	Sentiment database.SentimentStore
+	// Prices resolves polls against market prices, nil disables resolution
+	Prices market.PriceSource
+}
+
+func Init(ctx context.Context, app *fiber.App, options Options) error {
+	var (
+		workers   = options.Workers
+		providers = options.Providers
+		issuer    = options.Issuer
+		polls     = options.Polls
+		votes     = options.Votes
+		users     = options.Users
+		tickers   = options.Tickers
+		sentiment = options.Sentiment
+		prices    = options.Prices
+	)
+
 	sessionStore := session.New(session.Config{
-		Storage: storage.Redis(2),
+		Storage: storage.Get(options.Databases.Sessions),
+	})
+	sessionIndex := sessions.NewIndex(sessionStore)
+
+	resultsCache := storage.Get(options.Databases.Results)
+	hub := live.NewHub(live.DefaultMaxSubscribersPerPoll)
+	workers.Go(func() { hub.Run(ctx) })
+
+	// a single worker publishes the tallies, vote requests only queue the poll
+	// so they never add to the worker group while it is being waited on
+	publishQueue := make(chan int64, publishQueueSize)
+	workers.Go(func() { publishQueued(ctx, votes, hub, publishQueue) })
+
+	votes.OnVoteCommitted(func(_ context.Context, vote database.Vote) {
+		if err := resultsCache.Delete(resultsCacheKey(vote.PollID)); err != nil {
+			log.Error().Err(err).Int64("poll_id", vote.PollID).Msg("Failed to invalidate poll results")
+		}
+
+		// subscribers catch up with the next vote when an update is dropped
+		select {
+		case publishQueue <- vote.PollID:
+		default:
+			log.Warn().Int64("poll_id", vote.PollID).Msg("Publish queue full, dropping results update")
+		}
 	})
 
 	app.Route("/api", func(router fiber.Router) {
+		// registered before /v1/polls/:id which would match it
+		router.Get("/v1/polls/public", func(c *fiber.Ctx) error {
+			return listPolls(c, polls, database.PollFilter{Public: true})
+		})
+
+		router.Get("/v1/search", func(c *fiber.Ctx) error {
+			var query api.SearchRequest
+			if err := c.QueryParser(&query); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "malformed query string")
+			}
+
+			if err := query.Validate(); err != nil {
+				return err
+			}
+
+			results, err := polls.SearchPolls(c.Context(), query.Query, query.Limit)
+			if err != nil {
+				return err
+			}
+
+			for i := range results {
+				results[i].AuthorEmail = nil
+				results[i].UserID = nil
+			}
+
+			return c.JSON(api.Page[database.SearchResult]{Data: results})
+		})
+
+		router.Get("/v1/tickers", func(c *fiber.Ctx) error {
+			var query api.TickersRequest
+			if err := c.QueryParser(&query); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "malformed query string")
+			}
+
+			if err := query.Validate(); err != nil {
+				return err
+			}
+
+			results, err := tickers.SearchTickers(c.Context(), query.Prefix, query.Limit)
+			if err != nil {
+				return err
+			}
+
+			return c.JSON(api.Page[database.Ticker]{Data: results})
+		})
+
+		router.Get("/v1/tickers/:symbol/sentiment", func(c *fiber.Ctx) error {
+			registered, err := tickers.GetTicker(c.Context(), ticker.Normalize(c.Params("symbol")))
+			if err != nil {
+				return err
+			}
+
+			result, err := sentiment.GetTickerSentiment(c.Context(), registered.Symbol)
+			if err != nil {
+				return err
+			}
+
+			return c.JSON(result)
+		})
+
 		router.Route("/v1/polls/:id", func(poll fiber.Router) {
 			poll.Get("/", func(c *fiber.Ctx) error {
 				id, err := strconv.Atoi(c.Params("id"))
@@ -69,48 +256,197 @@ func Init(app *fiber.App) error {
 					return err
 				}
 
-				poll, err := database.GetPollByID(c.Context(), int64(id))
+				poll, err := polls.GetPollByID(c.Context(), int64(id))
 				if err != nil {
 					return err
 				}
 
+				// drafts are unpublished, only their author can tell they exist
+				if poll.Draft {
+					author, err := isAuthor(c, poll, sessionStore, issuer, users)
+					if err != nil {
+						return err
+					}
+
+					if !author {
+						return fiber.ErrNotFound
+					}
+				}
+
 				poll.AuthorEmail = nil
 
 				return c.JSON(poll)
 			})
 
-			poll.Post("/vote", func(c *fiber.Ctx) error {
+			poll.Get("/results", func(c *fiber.Ctx) error {
 				id, err := strconv.Atoi(c.Params("id"))
 				if err != nil {
 					return err
 				}
 
-				poll, err := database.GetPollByID(c.Context(), int64(id))
+				var results database.PollResults
+				if hit, err := storage.GetJSON(resultsCache, resultsCacheKey(int64(id)), &results); err != nil {
+					log.Error().Err(err).Int("poll_id", id).Msg("Failed to read cached poll results")
+				} else if hit {
+					return c.JSON(results)
+				}
+
+				fresh, err := votes.GetPollResults(c.Context(), int64(id))
+				if err != nil {
+					return err
+				}
+
+				if err := storage.SetJSON(resultsCache, resultsCacheKey(int64(id)), fresh, resultsCacheTTL); err != nil {
+					log.Error().Err(err).Int("poll_id", id).Msg("Failed to cache poll results")
+				}
+
+				return c.JSON(fresh)
+			})
+
+			poll.Get("/stream", func(c *fiber.Ctx) error {
+				id, initial, err := streamResults(c, votes)
 				if err != nil {
 					return err
 				}
 
-				var userID string
-				if s, err := sessionStore.Get(c); err != nil || s == nil {
-					userID = hash(c.IP())
-				} else {
-					session, _ := sessionStore.Get(c)
+				subscriber, err := hub.Subscribe(id)
+				if errors.Is(err, live.ErrTooManySubscribers) || errors.Is(err, live.ErrHubClosed) {
+					return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+				}
 
-					if session.Get("user_id") == nil {
-						userID = hash(c.IP())
-					} else {
-						userID = session.Get("user_id").(string)
+				if err != nil {
+					return err
+				}
+
+				c.Set(fiber.HeaderContentType, "text/event-stream")
+				c.Set(fiber.HeaderCacheControl, "no-cache")
+				c.Set(fiber.HeaderConnection, "keep-alive")
+				c.Set("X-Accel-Buffering", "no")
+
+				c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+					defer hub.Unsubscribe(subscriber)
+
+					heartbeat := time.NewTicker(streamHeartbeat)
+					defer heartbeat.Stop()
+
+					if err := writeEvent(w, "results", initial); err != nil {
+						return
 					}
+
+					// a failed flush means the client went away
+					for {
+						select {
+						case payload, ok := <-subscriber.C:
+							// the hub closed the stream, the server is shutting down
+							if !ok {
+								return
+							}
+
+							if err := writeEvent(w, "results", payload); err != nil {
+								return
+							}
+						case <-heartbeat.C:
+							if _, err := w.WriteString(": ping\n\n"); err != nil {
+								return
+							}
+
+							if err := w.Flush(); err != nil {
+								return
+							}
+						}
+					}
+				})
+
+				return nil
+			})
+
+			// the same stream as /stream over a WebSocket, messages from the client are ignored
+			poll.Get("/ws", func(c *fiber.Ctx) error {
+				if !websocket.IsWebSocketUpgrade(c) {
+					return fiber.ErrUpgradeRequired
 				}
 
-				var payload fiber.Map
-				if err := c.BodyParser(&payload); err != nil {
+				id, initial, err := streamResults(c, votes)
+				if err != nil {
 					return err
 				}
 
-				if _, err := database.InsertVote(c.Context(), database.Vote{
+				c.Locals("poll_id", id)
+				c.Locals("results", initial)
+
+				return c.Next()
+			}, websocket.New(func(conn *websocket.Conn) {
+				subscriber, err := hub.Subscribe(conn.Locals("poll_id").(int64))
+				if err != nil {
+					closeSocket(conn, websocket.CloseTryAgainLater, err.Error())
+					return
+				}
+				defer hub.Unsubscribe(subscriber)
+
+				// the read loop notices the client going away
+				gone := make(chan struct{})
+				go func() {
+					defer close(gone)
+
+					for {
+						if _, _, err := conn.ReadMessage(); err != nil {
+							return
+						}
+					}
+				}()
+
+				if err := conn.WriteMessage(websocket.TextMessage, conn.Locals("results").([]byte)); err != nil {
+					return
+				}
+
+				heartbeat := time.NewTicker(streamHeartbeat)
+				defer heartbeat.Stop()
+
+				for {
+					select {
+					case <-gone:
+						return
+					case payload, ok := <-subscriber.C:
+						if !ok {
+							closeSocket(conn, websocket.CloseGoingAway, "server shutting down")
+							return
+						}
+
+						if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+							return
+						}
+					case <-heartbeat.C:
+						if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteTimeout)); err != nil {
+							return
+						}
+					}
+				}
+			}))
+
+			poll.Post("/vote", func(c *fiber.Ctx) error {
+				id, err := strconv.Atoi(c.Params("id"))
+				if err != nil {
+					return err
+				}
+
+				poll, err := polls.GetPollByID(c.Context(), int64(id))
+				if err != nil {
+					return err
+				}
+
+				userID, err := voterID(c, sessionStore, issuer, users)
+				if err != nil {
+					return err
+				}
+
+				var payload api.VoteRequest
+				if err := parseRequest(c, &payload); err != nil {
+					return err
+				}
+
+				if _, err := votes.InsertVote(c.Context(), database.Vote{
 					PollID: poll.ID,
-					Value:  payload["value"].(string),
+					Value:  payload.Value,
 					UserID: userID,
 				}); err != nil {
 					return err
@@ -118,39 +454,89 @@ func Init(app *fiber.App) error {
 
 				return c.SendStatus(fiber.StatusAccepted)
 			})
+
+			poll.Delete("/vote", func(c *fiber.Ctx) error {
+				id, err := strconv.Atoi(c.Params("id"))
+				if err != nil {
+					return err
+				}
+
+				userID, err := voterID(c, sessionStore, issuer, users)
+				if err != nil {
+					return err
+				}
+
+				if err := votes.DeleteVote(c.Context(), int64(id), userID); err != nil {
+					return err
+				}
+
+				return c.SendStatus(fiber.StatusAccepted)
+			})
 		})
 
-		router.Use(authMiddleware(sessionStore))
+		router.Use(authMiddleware(sessionStore, issuer, users))
 
-		router.Get("/v1/users/me", authMiddleware(sessionStore), func(c *fiber.Ctx) error {
-			db := database.Get()
-			if db == nil {
-				return fiber.NewError(500, "Database not connected")
-			}
-			session, err := sessionStore.Get(c)
-			if err != nil {
-				return err
-			}
+		router.Get("/v1/users/me", func(c *fiber.Ctx) error {
+			return c.JSON(c.Locals("user").(*database.User))
+		})
 
-			userID, ok := session.Get("user_id").(string)
-			if !ok {
-				return c.SendStatus(fiber.StatusUnauthorized)
-			}
+		router.Route("/v1/users/me/sessions", func(sessionsRouter fiber.Router) {
+			sessionsRouter.Use(denyPersonalTokens)
 
-			user, err := database.GetUserByOAuthID(c.Context(), userID)
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to get user")
-				return fiber.ErrInternalServerError
-			}
+			sessionsRouter.Get("/", func(c *fiber.Ctx) error {
+				user := c.Locals("user").(*database.User)
+
+				session, err := sessionStore.Get(c)
+				if err != nil {
+					return err
+				}
+
+				rows, err := sessionIndex.List(user.OAuthID, session.ID())
+				if err != nil {
+					return err
+				}
+
+				return c.JSON(rows)
+			})
+
+			// log out everywhere
+			sessionsRouter.Delete("/", func(c *fiber.Ctx) error {
+				user := c.Locals("user").(*database.User)
+
+				if err := sessionIndex.RevokeAll(user.OAuthID); err != nil {
+					return err
+				}
+
+				if err := issuer.RevokeAll(user.OAuthID); err != nil {
+					return err
+				}
+
+				return c.SendStatus(fiber.StatusAccepted)
+			})
+
+			sessionsRouter.Delete("/:id", func(c *fiber.Ctx) error {
+				user := c.Locals("user").(*database.User)
+
+				found, err := sessionIndex.Revoke(user.OAuthID, c.Params("id"))
+				if err != nil {
+					return err
+				}
+
+				if !found {
+					return fiber.ErrNotFound
+				}
 
-			return c.JSON(user)
+				return c.SendStatus(fiber.StatusAccepted)
+			})
 		})
 
-		router.Route("/v1/polls", func(polls fiber.Router) {
-			polls.Get("/", func(c *fiber.Ctx) error {
+		router.Route("/v1/users/me/tokens", func(tokensRouter fiber.Router) {
+			tokensRouter.Use(denyPersonalTokens)
+
+			tokensRouter.Get("/", func(c *fiber.Ctx) error {
 				user := c.Locals("user").(*database.User)
 
-				rows, err := database.GetPollsByUserID(c.Context(), user.ID)
+				rows, err := users.GetPersonalAccessTokensByUserID(c.Context(), user.ID)
 				if err != nil {
 					return err
 				}
@@ -158,23 +544,100 @@ func Init(app *fiber.App) error {
 				return c.JSON(rows)
 			})
 
-			polls.Post("/", func(c *fiber.Ctx) error {
+			tokensRouter.Post("/", func(c *fiber.Ctx) error {
+				user := c.Locals("user").(*database.User)
+
+				var payload api.CreateTokenRequest
+				if err := parseRequest(c, &payload); err != nil {
+					return err
+				}
+
+				token, tokenHash := tokens.NewPersonalToken()
+				pat, err := users.InsertPersonalAccessToken(c.Context(), database.PersonalAccessToken{
+					UserID:    user.ID,
+					Name:      payload.Name,
+					Scopes:    payload.Scopes,
+					ExpiresAt: payload.ExpiresAt,
+				}, tokenHash)
+				if err != nil {
+					return err
+				}
+
+				// the plain token is only shown once
+				return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+					"token":   token,
+					"details": pat,
+				})
+			})
+
+			tokensRouter.Delete("/:id", func(c *fiber.Ctx) error {
+				user := c.Locals("user").(*database.User)
+
+				tokenID, err := strconv.Atoi(c.Params("id"))
+				if err != nil {
+					return err
+				}
+
+				deleted, err := users.DeletePersonalAccessTokenByIDAndUserID(c.Context(), tokenID, user.ID)
+				if err != nil {
+					return err
+				}
+
+				if deleted == 0 {
+					return fiber.ErrNotFound
+				}
+
+				return c.SendStatus(fiber.StatusAccepted)
+			})
+		})
+
+		router.Route("/v1/polls", func(pollsRouter fiber.Router) {
+			pollsRouter.Get("/", requireScope(tokens.ScopePollsRead), func(c *fiber.Ctx) error {
 				user := c.Locals("user").(*database.User)
 
-				var payload fiber.Map
-				if err := c.BodyParser(&payload); err != nil {
+				return listPolls(c, polls, database.PollFilter{UserID: &user.ID})
+			})
+
+			pollsRouter.Post("/", requireScope(tokens.ScopePollsWrite), func(c *fiber.Ctx) error {
+				user := c.Locals("user").(*database.User)
+
+				var payload api.CreatePollRequest
+				if err := parseRequest(c, &payload); err != nil {
 					return err
 				}
 
-				log.Info().Interface("payload", payload).Send()
-				description := payload["description"].(string)
+				if _, err := tickers.GetTicker(c.Context(), payload.Ticker); err != nil {
+					if errors.Is(err, database.ErrNotFound) {
+						return api.ValidationError{{Field: "ticker", Message: "is not a listed symbol"}}
+					}
 
-				pollID, err := database.InsertPoll(c.Context(), database.Poll{
-					Title:       payload["title"].(string),
+					return err
+				}
+
+				referencePrice, resolution, err := resolutionOf(c.Context(), prices, payload.Ticker, payload.Resolution)
+				if err != nil {
+					return err
+				}
+
+				options := make([]database.PollOption, len(payload.Options))
+				for i, option := range payload.Options {
+					options[i] = database.PollOption{Value: option.Value, Sentiment: option.Sentiment, MeetsRule: option.MeetsRule}
+				}
+
+				pollID, err := polls.InsertPoll(c.Context(), database.Poll{
+					Title:       payload.Title,
 					UserID:      &user.ID,
 					AuthorEmail: &user.Email,
-					Ticker:      payload["ticker"].(string),
-					Description: &description,
+					Ticker:      payload.Ticker,
+					Description: payload.Description,
+					Draft:       payload.Draft,
+					LockVotes:   payload.LockVotes,
+					OpensAt:     payload.OpensAt,
+					ClosesAt:    payload.ClosesAt,
+					Options:     options,
+
+					ReferencePrice: referencePrice,
+					Resolution:     resolution,
 				})
 				if err != nil {
 					return err
@@ -185,7 +648,7 @@ func Init(app *fiber.App) error {
 				})
 			})
 
-			polls.Delete("/:id", func(c *fiber.Ctx) error {
+			pollsRouter.Patch("/:id", requireScope(tokens.ScopePollsWrite), func(c *fiber.Ctx) error {
 				user := c.Locals("user").(*database.User)
 
 				pollID, err := strconv.Atoi(c.Params("id"))
@@ -193,10 +656,45 @@ func Init(app *fiber.App) error {
 					return err
 				}
 
-				if _, err := database.DeletePollByIDAndUserID(c.Context(), pollID, user.ID); err != nil {
+				var payload api.UpdatePollRequest
+				if err := parseRequest(c, &payload); err != nil {
 					return err
 				}
 
+				updated, err := polls.UpdatePollSchedule(c.Context(), pollID, user.ID, database.ScheduleUpdate{
+					Draft:         payload.Draft,
+					OpensAt:       payload.OpensAt,
+					ClosesAt:      payload.ClosesAt.Time,
+					ClearClosesAt: payload.ClosesAt.Set && payload.ClosesAt.Time == nil,
+				})
+				if err != nil {
+					return err
+				}
+
+				if updated == 0 {
+					return fiber.ErrNotFound
+				}
+
+				return c.SendStatus(fiber.StatusAccepted)
+			})
+
+			pollsRouter.Delete("/:id", requireScope(tokens.ScopePollsWrite), func(c *fiber.Ctx) error {
+				user := c.Locals("user").(*database.User)
+
+				pollID, err := strconv.Atoi(c.Params("id"))
+				if err != nil {
+					return err
+				}
+
+				deleted, err := polls.DeletePollByIDAndUserID(c.Context(), pollID, user.ID)
+				if err != nil {
+					return err
+				}
+
+				if deleted == 0 {
+					return fiber.ErrNotFound
+				}
+
 				return c.SendStatus(fiber.StatusAccepted)
 			})
 		})
@@ -208,6 +706,12 @@ func Init(app *fiber.App) error {
 			return err
 		}
 
+		if oauthID, ok := session.Get("user_id").(string); ok {
+			if err := sessionIndex.Remove(oauthID, session.ID()); err != nil {
+				log.Error().Err(err).Str("oauth_id", oauthID).Msg("Failed to remove session from index")
+			}
+		}
+
 		if err := session.Destroy(); err != nil {
 			return err
 		}
@@ -217,52 +721,64 @@ func Init(app *fiber.App) error {
 
 	app.Route("/oauth", func(router fiber.Router) {
 		router.Get("/:provider/login", func(c *fiber.Ctx) error {
+			provider, ok := providers.Get(c.Params("provider"))
+			if !ok {
+				return c.Render("login", fiber.Map{
+					"Providers": providers.Names(),
+				})
+			}
+
 			session, err := sessionStore.Get(c)
 			if err != nil {
 				return err
 			}
 
-			state := utils.RandomStringPrefixed("google_", 7)
+			state := utils.RandomStringPrefixed(provider.Name()+"_", 7)
+			nonce := utils.RandomID(32)
+			verifier := oauth2.GenerateVerifier()
+
 			session.Set("state", state)
+			session.Set("nonce", nonce)
+			session.Set("code_verifier", verifier)
 			if err := session.Save(); err != nil {
 				return err
 			}
 
-			switch c.Params("provider") {
-			case string(ProviderGoogle):
-				google, err := authenticator.GetGoogleAuthenticator()
-				if err != nil {
-					return err
-				}
-
-				url := google.AuthCodeURL(state)
-
-				accept := c.Get(fiber.HeaderAccept)
-				log.Info().Str("accept", accept).Send()
+			url, err := provider.AuthCodeURL(
+				c.UserContext(),
+				state,
+				nonce,
+				oauth2.S256ChallengeOption(verifier),
+			)
+			if err != nil {
+				return err
+			}
 
-				if acceptsHTML(c) && c.Query("skip") == "" {
-					return c.Render("oauth", fiber.Map{
-						"Url": url,
-					})
-				}
+			accept := c.Get(fiber.HeaderAccept)
+			log.Info().Str("accept", accept).Send()
 
-				if acceptsJSON(c) {
-					return c.JSON(fiber.Map{
-						"url": url,
-					})
-				}
+			if acceptsHTML(c) && c.Query("skip") == "" {
+				return c.Render("oauth", fiber.Map{
+					"Url":      url,
+					"Provider": provider.Name(),
+				})
+			}
 
-				return c.Status(fiber.StatusSeeOther).Redirect(url)
-			default:
-				return c.Render("login", fiber.Map{
-					"Providers": []string{
-						string(ProviderGoogle),
-					},
+			if acceptsJSON(c) {
+				return c.JSON(fiber.Map{
+					"url": url,
 				})
 			}
+
+			return c.Status(fiber.StatusSeeOther).Redirect(url)
 		})
 
 		router.Get("/:provider/callback", func(c *fiber.Ctx) error {
+			provider, ok := providers.Get(c.Params("provider"))
+			if !ok {
+				return fiber.ErrNotFound
+			}
+
 			session, err := sessionStore.Get(c)
 			if err != nil {
 				return err
@@ -279,50 +795,205 @@ func Init(app *fiber.App) error {
 				return fiber.ErrForbidden
 			}
 
-			switch c.Params("provider") {
-			case string(ProviderGoogle):
-				google, err := authenticator.GetGoogleAuthenticator()
-				if err != nil {
-					return err
-				}
+			nonce, _ := session.Get("nonce").(string)
+			verifier, ok := session.Get("code_verifier").(string)
+			if !ok {
+				return fiber.ErrForbidden
+			}
 
-				code := c.Query("code")
-				token, err := google.Exchange(
-					c.UserContext(),
-					code,
-				)
-				if err != nil {
-					return err
-				}
+			session.Delete("nonce")
+			session.Delete("code_verifier")
 
-				idToken, err := google.VerifyIDToken(c.Context(), token)
-				if err != nil {
-					return err
-				}
+			identity, err := provider.Authenticate(
+				c.UserContext(),
+				c.Query("code"),
+				nonce,
+				oauth2.VerifierOption(verifier),
+			)
+			if err != nil {
+				return err
+			}
 
-				var user GoogleUser
-				if err = idToken.Claims(&user); err != nil {
-					return err
-				}
+			if !identity.EmailVerified {
+				log.Warn().Str("provider", identity.Provider).Str("subject", identity.Subject).Msg("email not verified")
+				return fiber.ErrForbidden
+			}
 
-				session.Set("user_id", user.ID)
-				duration := time.Until(idToken.Expiry)
-				session.SetExpiry(duration)
+			user, err := users.UpsertUser(c.Context(), userFromIdentity(identity))
+			if err != nil {
+				return err
+			}
 
-				if err := session.Save(); err != nil {
-					return err
-				}
+			// a fresh session ID on login prevents session fixation
+			if err := session.Regenerate(); err != nil {
+				return err
+			}
 
-				return c.SendStatus(fiber.StatusOK)
-			default:
-				return fiber.ErrNotFound
+			session.Set("user_id", user.OAuthID)
+			if !identity.Expiry.IsZero() {
+				session.SetExpiry(time.Until(identity.Expiry))
+			}
+
+			sessionID := session.ID()
+			if err := session.Save(); err != nil {
+				return err
+			}
+
+			if err := sessionIndex.Add(c, user.OAuthID, sessionID); err != nil {
+				log.Error().Err(err).Str("oauth_id", user.OAuthID).Msg("Failed to index session")
+			}
+
+			pair, err := issuer.Issue(user.OAuthID)
+			if err != nil {
+				return err
+			}
+
+			return c.JSON(pair)
+		})
+
+		router.Post("/token", func(c *fiber.Ctx) error {
+			var payload struct {
+				GrantType    string `json:"grant_type" form:"grant_type"`
+				RefreshToken string `json:"refresh_token" form:"refresh_token"`
+			}
+			if err := c.BodyParser(&payload); err != nil {
+				return fiber.ErrBadRequest
+			}
+
+			if payload.GrantType != "refresh_token" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "unsupported_grant_type",
+				})
+			}
+
+			pair, err := issuer.Refresh(payload.RefreshToken)
+			if errors.Is(err, tokens.ErrInvalidToken) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "invalid_grant",
+				})
+			}
+
+			if err != nil {
+				return err
 			}
+
+			return c.JSON(pair)
+		})
+
+		// RFC 7009, unknown tokens are not an error
+		router.Post("/revoke", func(c *fiber.Ctx) error {
+			var payload struct {
+				Token string `json:"token" form:"token"`
+			}
+			if err := c.BodyParser(&payload); err != nil {
+				return fiber.ErrBadRequest
+			}
+
+			if err := issuer.Revoke(payload.Token); err != nil {
+				return err
+			}
+
+			return c.SendStatus(fiber.StatusOK)
 		})
 	})
 
 	return nil
 }
 
+// listPolls responds with the page of polls selected by the query and the filter,
+// authors are only shown to the owner
+func listPolls(c *fiber.Ctx, polls database.PollStore, filter database.PollFilter) error {
+	var query api.ListPollsRequest
+	if err := c.QueryParser(&query); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "malformed query string")
+	}
+
+	if err := query.Validate(); err != nil {
+		return err
+	}
+
+	filter.Ticker = query.Ticker
+	filter.Status = database.PollStatus(query.Status)
+	filter.CreatedAfter = query.From
+	filter.CreatedBefore = query.To
+	filter.Sort = database.PollSort(query.Sort)
+	filter.Limit = query.Limit
+
+	if query.Cursor != "" {
+		after, err := database.DecodePollCursor(query.Cursor, filter.Sort)
+		if err != nil {
+			return err
+		}
+
+		filter.After = after
+	}
+
+	page, err := polls.ListPolls(c.Context(), filter)
+	if err != nil {
+		return err
+	}
+
+	response := api.Page[database.Poll]{Data: page.Polls}
+	if page.Next != nil {
+		response.NextCursor = page.Next.Encode()
+	}
+
+	if filter.UserID == nil {
+		for i := range response.Data {
+			response.Data[i].AuthorEmail = nil
+			response.Data[i].UserID = nil
+		}
+	}
+
+	return c.JSON(response)
+}
+
+// resolutionOf captures the reference price of the ticker when prices are available,
+// and turns the rule into a resolution targeting that price by default
+func resolutionOf(ctx context.Context, prices market.PriceSource, ticker string, rule *api.ResolutionRule) (*float64, *database.Resolution, error) {
+	if prices == nil {
+		if rule != nil {
+			return nil, nil, api.ValidationError{{Field: "resolution", Message: "is not available on this server"}}
+		}
+
+		return nil, nil, nil
+	}
+
+	var referencePrice *float64
+	price, err := prices.PriceAt(ctx, ticker, time.Now().UTC())
+	switch {
+	case err == nil:
+		referencePrice = &price.Value
+	case !errors.Is(err, market.ErrNoPrice):
+		return nil, nil, err
+	}
+
+	if rule == nil {
+		return referencePrice, nil, nil
+	}
+
+	target := rule.Target
+	if target == nil {
+		target = referencePrice
+	}
+
+	if target == nil {
+		return nil, nil, api.ValidationError{{Field: "resolution.target", Message: "is required, there is no recent price of " + ticker}}
+	}
+
+	return referencePrice, &database.Resolution{Operator: rule.Operator, Target: *target}, nil
+}
+
+// parseRequest decodes the body into the request and validates it,
+// decoding errors are mapped by the error handler
+func parseRequest(c *fiber.Ctx, request api.Validator) error {
+	if err := c.BodyParser(request); err != nil {
+		return err
+	}
+
+	return request.Validate()
+}
+
 func safeEqual(a, b string) bool {
 	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
@@ -334,7 +1005,3 @@ func acceptsJSON(c *fiber.Ctx) bool {
 func acceptsHTML(c *fiber.Ctx) bool {
 	return strings.Contains(c.Get(fiber.HeaderAccept), "text/html")
 }
-
-func hash(s string) string {
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
-}
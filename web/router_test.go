@@ -0,0 +1,892 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fasthttpws "github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/template/html/v2"
+	"github.com/rawnly/votestreet/internal/config"
+	"github.com/rawnly/votestreet/internal/database"
+	"github.com/rawnly/votestreet/internal/database/memory"
+	"github.com/rawnly/votestreet/internal/jobs"
+	"github.com/rawnly/votestreet/internal/market"
+	"github.com/rawnly/votestreet/internal/sessions"
+	"github.com/rawnly/votestreet/internal/storage"
+	"github.com/rawnly/votestreet/internal/tokens"
+	"github.com/rawnly/votestreet/pkg/api"
+	"github.com/rawnly/votestreet/pkg/authenticator"
+	"golang.org/x/oauth2"
+)
+
+// testProvider is an identity provider accepting the codes "alice" and "unverified"
+type testProvider struct{}
+
+func (testProvider) Name() string {
+	return "test"
+}
+
+func (testProvider) AuthCodeURL(_ context.Context, state, nonce string, _ ...oauth2.AuthCodeOption) (string, error) {
+	return "https://idp.test/authorize?" + url.Values{"state": {state}, "nonce": {nonce}}.Encode(), nil
+}
+
+func (testProvider) Authenticate(_ context.Context, code, _ string, _ ...oauth2.AuthCodeOption) (*authenticator.Identity, error) {
+	switch code {
+	case "alice", "unverified":
+		return &authenticator.Identity{
+			Provider:      "test",
+			Subject:       code,
+			Email:         code + "@example.com",
+			EmailVerified: code == "alice",
+		}, nil
+	default:
+		return nil, fiber.ErrUnauthorized
+	}
+}
+
+// testPrices quotes every symbol at 100
+type testPrices struct{}
+
+func (testPrices) PriceAt(_ context.Context, symbol string, at time.Time) (market.Price, error) {
+	return market.Price{Symbol: symbol, At: at, Value: 100}, nil
+}
+
+type testServer struct {
+	app    *fiber.App
+	store  *memory.Store
+	issuer *tokens.Service
+}
+
+// newTestServer builds the router on the memory store and the memory storage backend
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	cfg := config.Default()
+	storage.Configure(config.Storage{Backend: storage.BackendMemory}, cfg.Redis)
+
+	// storages are shared by the tests of the package
+	for _, db := range []int{cfg.Redis.Databases.Sessions, cfg.Redis.Databases.Tokens, cfg.Redis.Databases.Results} {
+		if err := storage.Get(db).Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	issuer, err := tokens.New(strings.Repeat("k", 32), storage.Get(cfg.Redis.Databases.Tokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := &jobs.Group{}
+	t.Cleanup(func() {
+		cancel()
+		_ = workers.Wait(context.Background())
+	})
+
+	store := memory.New()
+	app := fiber.New(fiber.Config{
+		Views:                 html.New("../views", ".html"),
+		ErrorHandler:          ErrorHandler,
+		DisableStartupMessage: true,
+	})
+
+	if err := Init(ctx, app, Options{
+		Workers:   workers,
+		Databases: cfg.Redis.Databases,
+		Providers: authenticator.NewRegistry(testProvider{}),
+		Issuer:    issuer,
+		Polls:     store,
+		Votes:     store,
+		Users:     store,
+		Tickers:   store,
+		Sentiment: store,
+		Prices:    testPrices{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{app: app, store: store, issuer: issuer}
+}
+
+// request sends a request through app.Test, headers are name and value pairs
+func (s *testServer) request(t *testing.T, method, target string, body any, headers ...string) (*http.Response, []byte) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader = bytes.NewReader(payload)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, data
+}
+
+// expect sends the request and checks the status, the body is decoded into out if any
+func (s *testServer) expect(t *testing.T, status int, method, target string, body, out any, headers ...string) *http.Response {
+	t.Helper()
+
+	resp, data := s.request(t, method, target, body, headers...)
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s = %d, want %d: %s", method, target, resp.StatusCode, status, data)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, target, err, data)
+		}
+	}
+
+	return resp
+}
+
+// login creates the user and returns the Authorization header of an access token
+func (s *testServer) login(t *testing.T, name string) string {
+	t.Helper()
+
+	user, err := s.store.UpsertUser(context.Background(), database.User{
+		OAuthID: "test|" + name,
+		Email:   name + "@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + s.issue(t, user.OAuthID).AccessToken
+}
+
+// issue signs a token pair for the user
+func (s *testServer) issue(t *testing.T, oauthID string) *tokens.Pair {
+	t.Helper()
+
+	pair, err := s.issuer.Issue(oauthID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pair
+}
+
+// createPoll creates a poll as the user and returns its ID
+func (s *testServer) createPoll(t *testing.T, auth string, payload map[string]any) int64 {
+	t.Helper()
+
+	var created struct {
+		Inserted int64 `json:"inserted"`
+	}
+	s.expect(t, fiber.StatusCreated, "POST", "/api/v1/polls", payload, &created, fiber.HeaderAuthorization, auth)
+
+	return created.Inserted
+}
+
+func pollPath(id int64, suffix string) string {
+	return "/api/v1/polls/" + strconv.FormatInt(id, 10) + suffix
+}
+
+// invalidFields returns the fields listed by a problem response
+func invalidFields(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	var problem Problem
+	if err := json.Unmarshal(data, &problem); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make([]string, len(problem.Errors))
+	for i, field := range problem.Errors {
+		fields[i] = field.Field
+	}
+
+	return fields
+}
+
+func yesNo() []any {
+	return []any{
+		map[string]any{"value": "Yes", "sentiment": 1},
+		map[string]any{"value": "No", "sentiment": -1},
+	}
+}
+
+func TestPollRoutes(t *testing.T) {
+	s := newTestServer(t)
+	alice, bob := s.login(t, "alice"), s.login(t, "bob")
+	closesAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+
+	t.Run("create requires a login", func(t *testing.T) {
+		s.expect(t, fiber.StatusUnauthorized, "POST", "/api/v1/polls", map[string]any{}, nil)
+	})
+
+	t.Run("create validates the payload", func(t *testing.T) {
+		resp, data := s.request(t, "POST", "/api/v1/polls", map[string]any{
+			"title":   " ",
+			"ticker":  "aapl",
+			"options": []any{"Yes", map[string]any{"value": "No", "sentiment": 3}},
+		}, fiber.HeaderAuthorization, alice)
+
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", resp.StatusCode)
+		}
+
+		if fields := invalidFields(t, data); !slices.Equal(fields, []string{"title", "options[1].sentiment"}) {
+			t.Errorf("invalid fields = %v", fields)
+		}
+	})
+
+	t.Run("create rejects unlisted tickers", func(t *testing.T) {
+		_, data := s.request(t, "POST", "/api/v1/polls", map[string]any{
+			"title": "Unlisted", "ticker": "ZZZZ", "options": []string{"Yes", "No"},
+		}, fiber.HeaderAuthorization, alice)
+
+		if fields := invalidFields(t, data); !slices.Equal(fields, []string{"ticker"}) {
+			t.Errorf("invalid fields = %v", fields)
+		}
+	})
+
+	t.Run("create rejects malformed JSON", func(t *testing.T) {
+		s.expect(t, fiber.StatusBadRequest, "POST", "/api/v1/polls", map[string]any{"title": 1}, nil, fiber.HeaderAuthorization, alice)
+	})
+
+	id := s.createPoll(t, alice, map[string]any{
+		"title":     "Will AAPL close higher?",
+		"ticker":    "aapl",
+		"options":   yesNo(),
+		"closes_at": closesAt,
+	})
+
+	resolvable := s.createPoll(t, alice, map[string]any{
+		"title":      "Will MSFT close above 100?",
+		"ticker":     "MSFT",
+		"options":    []any{map[string]any{"value": "Yes", "meets_rule": true}, "No"},
+		"closes_at":  closesAt,
+		"resolution": map[string]any{"operator": "above"},
+	})
+
+	t.Run("create requires an option meeting the rule", func(t *testing.T) {
+		_, data := s.request(t, "POST", "/api/v1/polls", map[string]any{
+			"title":      "Will MSFT close above 100?",
+			"ticker":     "MSFT",
+			"options":    []string{"Yes", "No"},
+			"closes_at":  closesAt,
+			"resolution": map[string]any{"operator": "above"},
+		}, fiber.HeaderAuthorization, alice)
+
+		if fields := invalidFields(t, data); !slices.Equal(fields, []string{"options"}) {
+			t.Errorf("invalid fields = %v", fields)
+		}
+	})
+
+	t.Run("get hides the author", func(t *testing.T) {
+		var poll database.Poll
+		s.expect(t, fiber.StatusOK, "GET", pollPath(resolvable, "/"), nil, &poll)
+
+		if poll.Ticker != "MSFT" || poll.AuthorEmail != nil || len(poll.Options) != 2 {
+			t.Errorf("poll = %+v", poll)
+		}
+
+		if poll.Resolution == nil || poll.Resolution.Target != 100 || !poll.Options[0].MeetsRule || poll.Options[1].MeetsRule {
+			t.Errorf("resolution = %+v, options = %+v", poll.Resolution, poll.Options)
+		}
+	})
+
+	t.Run("get hides drafts from other users", func(t *testing.T) {
+		draft := s.createPoll(t, alice, map[string]any{
+			"title":   "Unpublished",
+			"ticker":  "AAPL",
+			"options": yesNo(),
+			"draft":   true,
+		})
+
+		s.expect(t, fiber.StatusNotFound, "GET", pollPath(draft, "/"), nil, nil)
+		s.expect(t, fiber.StatusNotFound, "GET", pollPath(draft, "/"), nil, nil, fiber.HeaderAuthorization, bob)
+		s.expect(t, fiber.StatusNotFound, "GET", pollPath(draft, "/"), nil, nil, fiber.HeaderAuthorization, "Bearer invalid")
+
+		var poll database.Poll
+		s.expect(t, fiber.StatusOK, "GET", pollPath(draft, "/"), nil, &poll, fiber.HeaderAuthorization, alice)
+		if poll.ID != draft || poll.Status != database.PollStatusDraft {
+			t.Errorf("poll = %+v, want the draft", poll)
+		}
+
+		s.expect(t, fiber.StatusAccepted, "DELETE", pollPath(draft, ""), nil, nil, fiber.HeaderAuthorization, alice)
+	})
+
+	t.Run("get unknown poll", func(t *testing.T) {
+		s.expect(t, fiber.StatusNotFound, "GET", pollPath(999, "/"), nil, nil)
+	})
+
+	t.Run("vote anonymously", func(t *testing.T) {
+		s.expect(t, fiber.StatusAccepted, "POST", pollPath(id, "/vote"), map[string]string{"value": "Yes"}, nil)
+		s.expect(t, fiber.StatusAccepted, "POST", pollPath(id, "/vote"), map[string]string{"value": "No"}, nil)
+
+		var results database.PollResults
+		s.expect(t, fiber.StatusOK, "GET", pollPath(id, "/results"), nil, &results)
+
+		if results.Total != 1 || results.Options[1].Count != 1 {
+			t.Errorf("results = %+v, want the changed vote", results)
+		}
+	})
+
+	t.Run("vote as a user", func(t *testing.T) {
+		s.expect(t, fiber.StatusAccepted, "POST", pollPath(id, "/vote"), map[string]string{"value": "Yes"}, nil, fiber.HeaderAuthorization, bob)
+
+		var results database.PollResults
+		s.expect(t, fiber.StatusOK, "GET", pollPath(id, "/results"), nil, &results)
+
+		if results.Total != 2 {
+			t.Errorf("results = %+v, want the cache invalidated", results)
+		}
+	})
+
+	t.Run("vote with invalid credentials", func(t *testing.T) {
+		s.expect(t, fiber.StatusUnauthorized, "POST", pollPath(id, "/vote"), map[string]string{"value": "Yes"}, nil, fiber.HeaderAuthorization, "Bearer invalid")
+		s.expect(t, fiber.StatusUnauthorized, "DELETE", pollPath(id, "/vote"), nil, nil, fiber.HeaderAuthorization, "Bearer "+tokens.PersonalTokenPrefix+"unknown")
+	})
+
+	t.Run("vote for an unknown option", func(t *testing.T) {
+		s.expect(t, fiber.StatusBadRequest, "POST", pollPath(id, "/vote"), map[string]string{"value": "Maybe"}, nil)
+	})
+
+	t.Run("retract a vote", func(t *testing.T) {
+		s.expect(t, fiber.StatusAccepted, "DELETE", pollPath(id, "/vote"), nil, nil, fiber.HeaderAuthorization, bob)
+		s.expect(t, fiber.StatusNotFound, "DELETE", pollPath(id, "/vote"), nil, nil, fiber.HeaderAuthorization, bob)
+	})
+
+	t.Run("update the schedule", func(t *testing.T) {
+		later := closesAt.Add(time.Hour)
+
+		s.expect(t, fiber.StatusAccepted, "PATCH", pollPath(id, ""), map[string]any{"closes_at": later}, nil, fiber.HeaderAuthorization, alice)
+		s.expect(t, fiber.StatusBadRequest, "PATCH", pollPath(id, ""), map[string]any{"opens_at": later.Add(time.Hour)}, nil, fiber.HeaderAuthorization, alice)
+		s.expect(t, fiber.StatusAccepted, "PATCH", pollPath(id, ""), map[string]any{"closes_at": nil}, nil, fiber.HeaderAuthorization, alice)
+		s.expect(t, fiber.StatusBadRequest, "PATCH", pollPath(id, ""), map[string]any{}, nil, fiber.HeaderAuthorization, alice)
+
+		var poll database.Poll
+		s.expect(t, fiber.StatusOK, "GET", pollPath(id, "/"), nil, &poll)
+
+		if poll.ClosesAt != nil {
+			t.Errorf("closes_at = %v, want it cleared", poll.ClosesAt)
+		}
+	})
+
+	t.Run("update keeps resolvable polls closing", func(t *testing.T) {
+		s.expect(t, fiber.StatusBadRequest, "PATCH", pollPath(resolvable, ""), map[string]any{"closes_at": nil}, nil, fiber.HeaderAuthorization, alice)
+	})
+
+	t.Run("update someone else's poll", func(t *testing.T) {
+		s.expect(t, fiber.StatusForbidden, "PATCH", pollPath(id, ""), map[string]any{"draft": true}, nil, fiber.HeaderAuthorization, bob)
+	})
+
+	t.Run("list own polls", func(t *testing.T) {
+		var first, second, others api.Page[database.Poll]
+
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/polls?limit=1", nil, &first, fiber.HeaderAuthorization, alice)
+		if len(first.Data) != 1 || first.Data[0].ID != resolvable || first.Data[0].AuthorEmail == nil || first.NextCursor == "" {
+			t.Fatalf("first page = %+v", first)
+		}
+
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/polls?limit=1&cursor="+url.QueryEscape(first.NextCursor), nil, &second, fiber.HeaderAuthorization, alice)
+		if len(second.Data) != 1 || second.Data[0].ID != id || second.NextCursor != "" {
+			t.Fatalf("second page = %+v", second)
+		}
+
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/polls", nil, &others, fiber.HeaderAuthorization, bob)
+		if len(others.Data) != 0 {
+			t.Errorf("bob sees %d polls, want none", len(others.Data))
+		}
+	})
+
+	t.Run("delete a poll", func(t *testing.T) {
+		s.expect(t, fiber.StatusForbidden, "DELETE", pollPath(id, ""), nil, nil, fiber.HeaderAuthorization, bob)
+		s.expect(t, fiber.StatusNotFound, "DELETE", pollPath(999, ""), nil, nil, fiber.HeaderAuthorization, alice)
+		s.expect(t, fiber.StatusAccepted, "DELETE", pollPath(id, ""), nil, nil, fiber.HeaderAuthorization, alice)
+		s.expect(t, fiber.StatusNotFound, "GET", pollPath(id, "/"), nil, nil)
+	})
+}
+
+func TestPublicRoutes(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login(t, "alice")
+
+	apple := s.createPoll(t, alice, map[string]any{
+		"title":       "Apple <b>earnings</b> beat?",
+		"description": "Quarterly results",
+		"ticker":      "AAPL",
+		"options":     yesNo(),
+	})
+	s.createPoll(t, alice, map[string]any{
+		"title":   "Apple draft",
+		"ticker":  "AAPL",
+		"options": yesNo(),
+		"draft":   true,
+	})
+	tesla := s.createPoll(t, alice, map[string]any{
+		"title":   "Tesla deliveries",
+		"ticker":  "TSLA",
+		"options": yesNo(),
+	})
+
+	t.Run("list public polls", func(t *testing.T) {
+		var all, filtered api.Page[database.Poll]
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/polls/public", nil, &all)
+
+		if len(all.Data) != 2 || all.Data[0].ID != tesla || all.Data[1].ID != apple {
+			t.Fatalf("polls = %+v, want the published polls newest first", all.Data)
+		}
+
+		if all.Data[0].AuthorEmail != nil || all.Data[0].UserID != nil {
+			t.Errorf("the author of %d is exposed", all.Data[0].ID)
+		}
+
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/polls/public?ticker=aapl", nil, &filtered)
+		if len(filtered.Data) != 1 || filtered.Data[0].ID != apple {
+			t.Errorf("polls of AAPL = %+v", filtered.Data)
+		}
+	})
+
+	t.Run("list rejects invalid queries", func(t *testing.T) {
+		s.expect(t, fiber.StatusBadRequest, "GET", "/api/v1/polls/public?status=archived", nil, nil)
+		s.expect(t, fiber.StatusBadRequest, "GET", "/api/v1/polls/public?cursor=invalid", nil, nil)
+		s.expect(t, fiber.StatusBadRequest, "GET", "/api/v1/polls/public?limit=1000", nil, nil)
+	})
+
+	t.Run("search escapes snippets", func(t *testing.T) {
+		var page api.Page[database.SearchResult]
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/search?q=apple", nil, &page)
+
+		if len(page.Data) != 1 || page.Data[0].ID != apple {
+			t.Fatalf("results = %+v", page.Data)
+		}
+
+		if snippet := page.Data[0].Snippet; strings.Contains(snippet, "<b>") || !strings.Contains(snippet, "&lt;b&gt;") {
+			t.Errorf("snippet = %q, want the markup escaped", snippet)
+		}
+
+		s.expect(t, fiber.StatusBadRequest, "GET", "/api/v1/search?q=", nil, nil)
+	})
+
+	t.Run("autocomplete tickers", func(t *testing.T) {
+		var page api.Page[database.Ticker]
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/tickers?prefix=aap", nil, &page)
+
+		if len(page.Data) == 0 || page.Data[0].Symbol != "AAPL" {
+			t.Errorf("tickers = %+v", page.Data)
+		}
+
+		s.expect(t, fiber.StatusBadRequest, "GET", "/api/v1/tickers?prefix="+strings.Repeat("a", 51), nil, nil)
+	})
+
+	t.Run("ticker sentiment", func(t *testing.T) {
+		s.expect(t, fiber.StatusAccepted, "POST", pollPath(apple, "/vote"), map[string]string{"value": "Yes"}, nil)
+
+		var sentiment database.TickerSentiment
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/tickers/aapl/sentiment", nil, &sentiment)
+
+		if sentiment.Symbol != "AAPL" || len(sentiment.Windows) != len(database.SentimentWindows) {
+			t.Fatalf("sentiment = %+v", sentiment)
+		}
+
+		if window := sentiment.Windows[0]; window.Bullish != 1 || window.Index == nil || *window.Index != 1 {
+			t.Errorf("window = %+v, want one bullish vote", window)
+		}
+
+		s.expect(t, fiber.StatusNotFound, "GET", "/api/v1/tickers/ZZZZ/sentiment", nil, nil)
+	})
+}
+
+func TestStreamRoutes(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.login(t, "alice")
+	id := s.createPoll(t, alice, map[string]any{"title": "Streamed", "ticker": "AAPL", "options": yesNo()})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { _ = s.app.Listener(listener) }()
+	t.Cleanup(func() { _ = s.app.ShutdownWithTimeout(time.Second) })
+
+	addr := listener.Addr().String()
+
+	// startVoting keeps changing the anonymous vote until stopped,
+	// a subscriber may miss the votes cast while it connects
+	votes := 0
+	startVoting := func(t *testing.T) (stop func()) {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+
+			for {
+				value := []string{"Yes", "No"}[votes%2]
+				votes++
+
+				if resp, data := s.request(t, "POST", pollPath(id, "/vote"), map[string]string{"value": value}); resp.StatusCode != fiber.StatusAccepted {
+					t.Errorf("vote = %d: %s", resp.StatusCode, data)
+					return
+				}
+
+				select {
+				case <-done:
+					return
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		}()
+
+		return func() {
+			close(done)
+			<-stopped
+		}
+	}
+
+	t.Run("websocket upgrade required", func(t *testing.T) {
+		s.expect(t, fiber.StatusUpgradeRequired, "GET", pollPath(id, "/ws"), nil, nil)
+	})
+
+	t.Run("server-sent events", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr+pollPath(id, "/stream"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		if contentType := resp.Header.Get(fiber.HeaderContentType); contentType != "text/event-stream" {
+			t.Fatalf("content type = %q", contentType)
+		}
+
+		events := make(chan database.PollResults)
+		go func() {
+			defer close(events)
+
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+				if !ok {
+					continue
+				}
+
+				var results database.PollResults
+				if json.Unmarshal([]byte(data), &results) != nil {
+					continue
+				}
+
+				select {
+				case events <- results:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		if initial, ok := <-events; !ok || initial.PollID != id || initial.Total != 0 {
+			t.Fatalf("initial results = %+v", initial)
+		}
+
+		stop := startVoting(t)
+		defer stop()
+
+		if update, ok := <-events; !ok || update.Total != 1 {
+			t.Errorf("update = %+v, want the new vote", update)
+		}
+	})
+
+	t.Run("websocket", func(t *testing.T) {
+		dialer := fasthttpws.Dialer{HandshakeTimeout: 5 * time.Second}
+		conn, _, err := dialer.Dial("ws://"+addr+pollPath(id, "/ws"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var initial database.PollResults
+		if err := conn.ReadJSON(&initial); err != nil || initial.PollID != id || initial.Total != 1 {
+			t.Fatalf("initial results = %+v, %v", initial, err)
+		}
+
+		stop := startVoting(t)
+		defer stop()
+
+		var update database.PollResults
+		if err := conn.ReadJSON(&update); err != nil || update.PollID != id {
+			t.Errorf("update = %+v, %v", update, err)
+		}
+	})
+
+	t.Run("unknown poll", func(t *testing.T) {
+		s.expect(t, fiber.StatusNotFound, "GET", pollPath(999, "/stream"), nil, nil)
+		s.expect(t, fiber.StatusNotFound, "GET", pollPath(999, "/ws"), nil, nil,
+			fiber.HeaderConnection, "Upgrade",
+			fiber.HeaderUpgrade, "websocket",
+			"Sec-WebSocket-Version", "13",
+			"Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==",
+		)
+	})
+}
+
+func TestAuthRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	// oauthLogin goes through the login and callback routes,
+	// returns the session cookie and the tokens of a successful login
+	oauthLogin := func(t *testing.T, code string, status int) (string, tokens.Pair) {
+		t.Helper()
+
+		var login struct {
+			URL string `json:"url"`
+		}
+		resp := s.expect(t, fiber.StatusOK, "GET", "/oauth/test/login", nil, &login, fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+
+		started := sessionCookie(t, resp)
+
+		consent, err := url.Parse(login.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var pair tokens.Pair
+		query := url.Values{"state": {consent.Query().Get("state")}, "code": {code}}
+		if status != fiber.StatusOK {
+			s.expect(t, status, "GET", "/oauth/test/callback?"+query.Encode(), nil, nil, fiber.HeaderCookie, started)
+			return "", pair
+		}
+
+		resp = s.expect(t, status, "GET", "/oauth/test/callback?"+query.Encode(), nil, &pair, fiber.HeaderCookie, started)
+
+		cookie := sessionCookie(t, resp)
+		if cookie == started {
+			t.Fatal("callback did not regenerate the session")
+		}
+
+		return cookie, pair
+	}
+
+	t.Run("login page lists the providers", func(t *testing.T) {
+		resp, data := s.request(t, "GET", "/oauth/unknown/login", nil)
+
+		if resp.StatusCode != fiber.StatusOK || !strings.Contains(string(data), "/oauth/test/login") {
+			t.Errorf("login page = %d: %s", resp.StatusCode, data)
+		}
+	})
+
+	t.Run("login redirects to the provider", func(t *testing.T) {
+		resp, _ := s.request(t, "GET", "/oauth/test/login", nil)
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+			t.Fatalf("status = %d, want a redirect", resp.StatusCode)
+		}
+
+		if location := resp.Header.Get(fiber.HeaderLocation); !strings.HasPrefix(location, "https://idp.test/authorize?") {
+			t.Errorf("location = %q", location)
+		}
+	})
+
+	t.Run("callback checks the state", func(t *testing.T) {
+		s.expect(t, fiber.StatusForbidden, "GET", "/oauth/test/callback?state=forged&code=alice", nil, nil)
+		s.expect(t, fiber.StatusNotFound, "GET", "/oauth/unknown/callback", nil, nil)
+	})
+
+	t.Run("callback requires a verified email", func(t *testing.T) {
+		oauthLogin(t, "unverified", fiber.StatusForbidden)
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		s.expect(t, fiber.StatusUnauthorized, "GET", "/api/v1/users/me", nil, nil)
+		s.expect(t, fiber.StatusUnauthorized, "GET", "/api/v1/users/me", nil, nil, fiber.HeaderAuthorization, "Bearer invalid")
+	})
+
+	cookie, pair := oauthLogin(t, "alice", fiber.StatusOK)
+
+	t.Run("session login", func(t *testing.T) {
+		var user database.User
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/users/me", nil, &user, fiber.HeaderCookie, cookie)
+
+		if user.OAuthID != "test|alice" || user.Email != "alice@example.com" {
+			t.Errorf("user = %+v", user)
+		}
+
+		var rows []sessions.Info
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/users/me/sessions", nil, &rows, fiber.HeaderCookie, cookie)
+
+		if len(rows) != 1 || !rows[0].Current {
+			t.Errorf("sessions = %+v, want the current one", rows)
+		}
+
+		s.expect(t, fiber.StatusNotFound, "DELETE", "/api/v1/users/me/sessions/unknown", nil, nil, fiber.HeaderCookie, cookie)
+	})
+
+	t.Run("revoke another session", func(t *testing.T) {
+		other, _ := oauthLogin(t, "alice", fiber.StatusOK)
+
+		var rows []sessions.Info
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/users/me/sessions", nil, &rows, fiber.HeaderCookie, cookie)
+		if len(rows) != 2 {
+			t.Fatalf("sessions = %+v, want both logins", rows)
+		}
+
+		i := slices.IndexFunc(rows, func(row sessions.Info) bool { return !row.Current })
+		if i < 0 {
+			t.Fatalf("sessions = %+v, want another one", rows)
+		}
+
+		s.expect(t, fiber.StatusAccepted, "DELETE", "/api/v1/users/me/sessions/"+url.PathEscape(rows[i].ID), nil, nil, fiber.HeaderCookie, cookie)
+		s.expect(t, fiber.StatusUnauthorized, "GET", "/api/v1/users/me", nil, nil, fiber.HeaderCookie, other)
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/users/me", nil, nil, fiber.HeaderCookie, cookie)
+
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/users/me/sessions", nil, &rows, fiber.HeaderCookie, cookie)
+		if len(rows) != 1 || !rows[0].Current {
+			t.Errorf("sessions = %+v, want the current one left", rows)
+		}
+	})
+
+	t.Run("token login", func(t *testing.T) {
+		var user database.User
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/users/me", nil, &user, fiber.HeaderAuthorization, "Bearer "+pair.AccessToken)
+
+		if user.OAuthID != "test|alice" {
+			t.Errorf("user = %+v", user)
+		}
+	})
+
+	t.Run("refresh and revoke tokens", func(t *testing.T) {
+		var refreshed tokens.Pair
+		s.expect(t, fiber.StatusOK, "POST", "/oauth/token", map[string]string{
+			"grant_type": "refresh_token", "refresh_token": pair.RefreshToken,
+		}, &refreshed)
+
+		var grantErr struct {
+			Error string `json:"error"`
+		}
+		s.expect(t, fiber.StatusBadRequest, "POST", "/oauth/token", map[string]string{"grant_type": "password"}, &grantErr)
+		if grantErr.Error != "unsupported_grant_type" {
+			t.Errorf("error = %q", grantErr.Error)
+		}
+
+		s.expect(t, fiber.StatusOK, "POST", "/oauth/revoke", map[string]string{"token": refreshed.RefreshToken}, nil)
+		s.expect(t, fiber.StatusOK, "POST", "/oauth/revoke", map[string]string{"token": "unknown"}, nil)
+
+		s.expect(t, fiber.StatusBadRequest, "POST", "/oauth/token", map[string]string{
+			"grant_type": "refresh_token", "refresh_token": refreshed.RefreshToken,
+		}, &grantErr)
+		if grantErr.Error != "invalid_grant" {
+			t.Errorf("error = %q", grantErr.Error)
+		}
+	})
+
+	t.Run("personal access tokens", func(t *testing.T) {
+		auth := "Bearer " + pair.AccessToken
+		id := s.createPoll(t, auth, map[string]any{"title": "Tokens", "ticker": "AAPL", "options": yesNo()})
+
+		resp, data := s.request(t, "POST", "/api/v1/users/me/tokens", map[string]any{
+			"name": " ", "scopes": []string{tokens.ScopePollsRead, "admin"},
+		}, fiber.HeaderAuthorization, auth)
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", resp.StatusCode)
+		}
+
+		if fields := invalidFields(t, data); !slices.Equal(fields, []string{"name", "scopes[1]"}) {
+			t.Errorf("invalid fields = %v", fields)
+		}
+
+		var created struct {
+			Token   string                       `json:"token"`
+			Details database.PersonalAccessToken `json:"details"`
+		}
+		s.expect(t, fiber.StatusCreated, "POST", "/api/v1/users/me/tokens", map[string]any{
+			"name": "ci", "scopes": []string{tokens.ScopePollsRead},
+		}, &created, fiber.HeaderAuthorization, auth)
+
+		var listed []database.PersonalAccessToken
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/users/me/tokens", nil, &listed, fiber.HeaderAuthorization, auth)
+		if len(listed) != 1 || listed[0].Name != "ci" {
+			t.Errorf("tokens = %+v", listed)
+		}
+
+		personal := "Bearer " + created.Token
+		s.expect(t, fiber.StatusOK, "GET", "/api/v1/polls", nil, nil, fiber.HeaderAuthorization, personal)
+		s.expect(t, fiber.StatusForbidden, "POST", "/api/v1/polls", map[string]any{}, nil, fiber.HeaderAuthorization, personal)
+		s.expect(t, fiber.StatusForbidden, "POST", pollPath(id, "/vote"), map[string]string{"value": "Yes"}, nil, fiber.HeaderAuthorization, personal)
+		s.expect(t, fiber.StatusForbidden, "GET", "/api/v1/users/me/tokens", nil, nil, fiber.HeaderAuthorization, personal)
+		s.expect(t, fiber.StatusForbidden, "GET", "/api/v1/users/me/sessions", nil, nil, fiber.HeaderAuthorization, personal)
+
+		tokenPath := "/api/v1/users/me/tokens/" + strconv.Itoa(created.Details.ID)
+		s.expect(t, fiber.StatusAccepted, "DELETE", tokenPath, nil, nil, fiber.HeaderAuthorization, auth)
+		s.expect(t, fiber.StatusNotFound, "DELETE", tokenPath, nil, nil, fiber.HeaderAuthorization, auth)
+		s.expect(t, fiber.StatusUnauthorized, "GET", "/api/v1/polls", nil, nil, fiber.HeaderAuthorization, personal)
+	})
+
+	t.Run("log out everywhere", func(t *testing.T) {
+		refresh := s.issue(t, "test|alice").RefreshToken
+
+		s.expect(t, fiber.StatusAccepted, "DELETE", "/api/v1/users/me/sessions", nil, nil, fiber.HeaderCookie, cookie)
+		s.expect(t, fiber.StatusUnauthorized, "GET", "/api/v1/users/me", nil, nil, fiber.HeaderCookie, cookie)
+		s.expect(t, fiber.StatusBadRequest, "POST", "/oauth/token", map[string]string{
+			"grant_type": "refresh_token", "refresh_token": refresh,
+		}, nil)
+	})
+
+	t.Run("log out", func(t *testing.T) {
+		cookie, _ := oauthLogin(t, "alice", fiber.StatusOK)
+
+		s.expect(t, fiber.StatusAccepted, "POST", "/logout", nil, nil, fiber.HeaderCookie, cookie)
+		s.expect(t, fiber.StatusUnauthorized, "GET", "/api/v1/users/me", nil, nil, fiber.HeaderCookie, cookie)
+	})
+}
+
+// sessionCookie returns the session cookie set by the response, as a Cookie header
+func sessionCookie(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" {
+			return cookie.Name + "=" + cookie.Value
+		}
+	}
+
+	t.Fatal("no session cookie")
+	return ""
+}